@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Close reasons recorded in the access log
+const (
+	CloseClientClosed  = "client_closed"
+	CloseRemoteClosed  = "remote_closed"
+	CloseClientError   = "client_error"
+	CloseRemoteError   = "remote_error"
+	CloseSSHError      = "ssh_error"
+	CloseDialFailed    = "dial_failed"
+	CloseDenied        = "denied"
+	CloseLimited       = "limited"
+	CloseFaultInjected = "fault_injected"
+	CloseShutdown      = "shutdown"
+)
+
+// AccessRecord is one JSON line in the access log, describing a single forwarded connection
+type AccessRecord struct {
+	Time          time.Time `json:"time"`
+	ConnID        uint64    `json:"conn_id"`
+	Client        string    `json:"client"`
+	ClientPID     int       `json:"client_pid,omitempty"`
+	ClientProcess string    `json:"client_process,omitempty"`
+	Local         string    `json:"local"`
+	Remote        string    `json:"remote"`
+	JumpHost      string    `json:"jump_host"`
+	DurationMS    int64     `json:"duration_ms"`
+	BytesIn       int64     `json:"bytes_in"`
+	BytesOut      int64     `json:"bytes_out"`
+	CloseReason   string    `json:"close_reason"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// AccessLog writes one JSON record per forwarded connection to its own rotating file.
+// The file is only created once the first record is written.
+type AccessLog struct {
+	path     string
+	rotation LogRotationConfig
+
+	mu   sync.Mutex
+	file *RotatingFile
+}
+
+// NewAccessLog creates an access log that writes to path
+func NewAccessLog(path string, rotation LogRotationConfig) *AccessLog {
+	return &AccessLog{
+		path:     path,
+		rotation: rotation,
+	}
+}
+
+// SetRotation replaces the rotation settings, including those of the file if it's open
+func (al *AccessLog) SetRotation(rotation LogRotationConfig) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	al.rotation = rotation
+	if al.file != nil {
+		al.file.SetRotation(rotation)
+	}
+}
+
+// Log appends a record to the access log
+func (al *AccessLog) Log(record AccessRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		slog.Error("Failed to encode access log record", "conn_id", record.ConnID, "error", err)
+		return
+	}
+	data = append(data, '\n')
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if al.file == nil {
+		file, err := OpenRotatingFile(al.path, al.rotation)
+		if err != nil {
+			slog.Error("Failed to open access log", "path", al.path, "error", err)
+			return
+		}
+		al.file = file
+	}
+
+	if _, err := al.file.Write(data); err != nil {
+		slog.Error("Failed to write access log", "path", al.path, "error", err)
+	}
+}
+
+// Close closes the access log file if it was opened
+func (al *AccessLog) Close() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if al.file == nil {
+		return nil
+	}
+	err := al.file.Close()
+	al.file = nil
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	al := NewAccessLog(path, LogRotationConfig{})
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Access log should not be created before the first record")
+	}
+
+	al.Log(AccessRecord{
+		Time:        time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		ConnID:      1,
+		Client:      "127.0.0.1:51234",
+		Local:       "127.0.0.2:5432",
+		Remote:      "db.example.com:5432",
+		JumpHost:    "bastion.example.com:22",
+		DurationMS:  1500,
+		BytesIn:     10,
+		BytesOut:    20,
+		CloseReason: CloseClientClosed,
+	})
+	al.Log(AccessRecord{ConnID: 2, CloseReason: CloseDialFailed, Error: "connection refused"})
+	if err := al.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %q", len(lines), data)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Record is not valid JSON: %v", err)
+	}
+	if record["local"] != "127.0.0.2:5432" || record["close_reason"] != "client_closed" || record["bytes_out"] != float64(20) {
+		t.Errorf("Unexpected record: %v", record)
+	}
+	if _, exists := record["error"]; exists {
+		t.Errorf("Empty error should be omitted: %v", record)
+	}
+}
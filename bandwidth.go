@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxThrottleChunk bounds how much a throttled write sends at once so bandwidth is
+// shared smoothly between connections instead of in io.Copy-sized bursts
+const maxThrottleChunk = 16 * 1024
+
+// BandwidthLimit caps throughput in bytes per second in each direction (0 = unlimited)
+type BandwidthLimit struct {
+	Up   ByteSize `yaml:"up"`   // From local clients to the remote
+	Down ByteSize `yaml:"down"` // From the remote back to local clients
+}
+
+// validate checks the limit for invalid values; name prefixes error messages
+func (b BandwidthLimit) validate(name string) error {
+	if b.Up < 0 {
+		return fmt.Errorf("invalid %s.up: must not be negative", name)
+	}
+	if b.Down < 0 {
+		return fmt.Errorf("invalid %s.down: must not be negative", name)
+	}
+	return nil
+}
+
+// tokenBucket paces byte transfers to a fixed rate, allowing up to one second of burst
+type tokenBucket struct {
+	rate float64 // Bytes per second
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a bucket for bytesPerSecond, or returns nil when unlimited
+func newTokenBucket(bytesPerSecond ByteSize) *tokenBucket {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n tokens and returns how long the caller must wait before sending.
+// Tokens may go negative so concurrent writers queue up behind each other.
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.rate, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// chunkSize returns the largest write that fits within one second of the bucket's rate
+func (b *tokenBucket) chunkSize() int {
+	return max(1, min(maxThrottleChunk, int(b.rate)))
+}
+
+// throttledWriter delays writes until every bucket it shares has capacity
+type throttledWriter struct {
+	w       io.Writer
+	buckets []*tokenBucket
+	chunk   int
+}
+
+// newThrottledWriter wraps w so writes are paced by the given buckets, skipping nil
+// (unlimited) ones. It returns w unchanged when no bucket applies.
+func newThrottledWriter(w io.Writer, buckets ...*tokenBucket) io.Writer {
+	tw := &throttledWriter{w: w, chunk: maxThrottleChunk}
+	for _, bucket := range buckets {
+		if bucket != nil {
+			tw.buckets = append(tw.buckets, bucket)
+			tw.chunk = min(tw.chunk, bucket.chunkSize())
+		}
+	}
+	if len(tw.buckets) == 0 {
+		return w
+	}
+	return tw
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), tw.chunk)]
+
+		now := time.Now()
+		var wait time.Duration
+		for _, bucket := range tw.buckets {
+			wait = max(wait, bucket.reserve(now, len(chunk)))
+		}
+		time.Sleep(wait)
+
+		n, err := tw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
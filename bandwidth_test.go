@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	bucket := newTokenBucket(1000)
+	now := bucket.last
+
+	if wait := bucket.reserve(now, 1000); wait != 0 {
+		t.Errorf("reserve() within burst = %v, want 0", wait)
+	}
+	if wait := bucket.reserve(now, 500); wait != 500*time.Millisecond {
+		t.Errorf("reserve() over burst = %v, want 500ms", wait)
+	}
+	// A second writer queues behind the first
+	if wait := bucket.reserve(now, 500); wait != time.Second {
+		t.Errorf("reserve() queued = %v, want 1s", wait)
+	}
+	// Refill never exceeds one second of burst
+	if wait := bucket.reserve(now.Add(10*time.Second), 1000); wait != 0 {
+		t.Errorf("reserve() after refill = %v, want 0", wait)
+	}
+	if wait := bucket.reserve(now.Add(10*time.Second), 100); wait != 100*time.Millisecond {
+		t.Errorf("reserve() after burst = %v, want 100ms", wait)
+	}
+}
+
+func TestNewThrottledWriterUnlimited(t *testing.T) {
+	var buf bytes.Buffer
+	if w := newThrottledWriter(&buf, nil, newTokenBucket(0)); w != &buf {
+		t.Errorf("newThrottledWriter() without limits = %T, want the original writer", w)
+	}
+}
+
+func TestThrottledWriter(t *testing.T) {
+	var buf bytes.Buffer
+	host := newTokenBucket(10000)
+	global := newTokenBucket(1 << 20)
+	w := newThrottledWriter(&buf, host, global)
+
+	payload := bytes.Repeat([]byte("x"), 12000)
+	start := time.Now()
+	n, err := w.Write(payload)
+	elapsed := time.Since(start)
+
+	if err != nil || n != len(payload) {
+		t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(payload))
+	}
+	if !bytes.Equal(buf.Bytes(), payload) {
+		t.Error("Write() did not pass the payload through unchanged")
+	}
+	// The first 10000 bytes are burst; the remaining 2000 take 200ms at 10000 B/s
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("Write() took %v, expected it to be throttled to ~200ms", elapsed)
+	}
+}
+
+func TestBandwidthLimitValidate(t *testing.T) {
+	tests := []struct {
+		limit     BandwidthLimit
+		shouldErr bool
+	}{
+		{BandwidthLimit{}, false},
+		{BandwidthLimit{Up: 1 << 20, Down: 10 << 20}, false},
+		{BandwidthLimit{Up: -1}, true},
+		{BandwidthLimit{Down: -1}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.limit.validate("bandwidth_limit")
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("validate(%+v) error = %v, shouldErr %v", tt.limit, err, tt.shouldErr)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commands are the subcommands run from the terminal instead of starting the tray app.
+// Each gets the arguments after its name and returns the process exit code.
+var commands = map[string]func(args []string) int{
+	"exec":     runExec,
+	"export":   runExport,
+	"import":   runImport,
+	"schema":   runSchema,
+	"validate": runValidate,
+}
+
+// runCommand runs the subcommand named by args[0], reporting whether there was one
+func runCommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	command, exists := commands[args[0]]
+	if !exists {
+		return 0, false
+	}
+	return command(args[1:]), true
+}
+
+// commandConfigPath returns the config file a subcommand should use: the one given, else
+// the one the tray app would load
+func commandConfigPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	return FindConfigPath()
+}
+
+// commandHosts loads the config a subcommand acts on, with the profile the tray app would
+// use or the one given, and the hosts it selects. With names, only those hosts are
+// returned, in the order given and whether or not they're enabled; otherwise every enabled
+// host is.
+func commandHosts(path, profile, names string) (*Config, []HostConfig, error) {
+	state, err := LoadState(StatePath(path))
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := loadProfileConfig(path, profile, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if names == "" {
+		var hosts []HostConfig
+		for _, host := range config.Hosts {
+			if state.hostEnabled(host) {
+				hosts = append(hosts, host)
+			}
+		}
+		return config, hosts, nil
+	}
+
+	byName := make(map[string]HostConfig, len(config.Hosts))
+	for _, host := range config.Hosts {
+		byName[host.Name] = host
+	}
+	var hosts []HostConfig
+	for _, name := range strings.Split(names, ",") {
+		host, exists := byName[strings.TrimSpace(name)]
+		if !exists {
+			return nil, nil, fmt.Errorf("no host named %q in %s", strings.TrimSpace(name), path)
+		}
+		hosts = append(hosts, host)
+	}
+	return config, hosts, nil
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
 	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,35 +21,166 @@ const (
 	GlobalConfigPath  = "~/.config/portsmith/config.yaml"
 	DefaultKeyPath    = "~/.ssh/id_rsa"
 	SSHDefaultPort    = 22
+
+	// DefaultDrainTimeout is how long Stop waits for open connections to finish
+	DefaultDrainTimeout = 10 * time.Second
 )
 
 // HostConfig represents configuration for a single forwarding target
 type HostConfig struct {
-	LocalIP       string        `yaml:"local_ip"`
-	Hostnames     []string      `yaml:"hostnames"`
-	RemoteHost    string        `yaml:"remote_host"`
-	JumpHost      string        `yaml:"jump_host"`
-	JumpPort      int           `yaml:"jump_port"`
-	KeyPath       string        `yaml:"key_path"`
-	IdentityAgent string        `yaml:"identity_agent"`
-	Ports         []interface{} `yaml:"ports"` // Supports both ints (80) and strings ("100-105")
+	Name             string           `yaml:"name"`    // Identifies the host in the tray and state file (default: first hostname, else local_ip or local_socket)
+	Enabled          *bool            `yaml:"enabled"` // Set to false to keep the host configured but not forwarded (default: true)
+	Extends          string           `yaml:"extends"` // Template to inherit settings from
+	LocalIP          string           `yaml:"local_ip"`
+	Hostnames        []string         `yaml:"hostnames"`
+	RemoteHost       string           `yaml:"remote_host"`
+	JumpHost         string           `yaml:"jump_host"`
+	JumpPort         int              `yaml:"jump_port"`
+	KeyPath          string           `yaml:"key_path"`
+	IdentityAgent    string           `yaml:"identity_agent"`
+	KeyPassphrase    string           `yaml:"key_passphrase"`    // Passphrase for key_path, or a secret reference like exec:... or file:...
+	Password         string           `yaml:"password"`          // Password for the jump host, or a secret reference
+	Ports            []interface{}    `yaml:"ports"`             // Supports both ints (80) and strings ("100-105")
+	RemoteSocket     string           `yaml:"remote_socket"`     // Unix socket on the jump host to forward to instead of remote_host:port
+	LocalSocket      string           `yaml:"local_socket"`      // Local Unix socket path to expose remote_socket on
+	AccessLog        bool             `yaml:"access_log"`        // Write a JSON record per forwarded connection to access.log
+	IdentifyClients  bool             `yaml:"identify_clients"`  // Resolve the local process behind each connection
+	AllowedProcesses []string         `yaml:"allowed_processes"` // Only forward connections from these executables (names or full paths)
+	Limits           ConnectionLimits `yaml:"limits"`            // Per-forward connection and rate limits
+	BandwidthLimit   BandwidthLimit   `yaml:"bandwidth_limit"`   // Throughput cap shared by all of this host's connections
+	Faults           FaultConfig      `yaml:"faults"`            // Failures to inject for testing clients
+	Hooks            HooksConfig      `yaml:"hooks"`             // Commands to run on this host's events, in addition to the global hooks
+	Source           string           `yaml:"-"`                 // Files the host is defined in, for error messages
+}
+
+// MetricsConfig configures the optional Prometheus/OpenMetrics endpoint
+type MetricsConfig struct {
+	Listen string `yaml:"listen"` // Loopback address to serve /metrics on, e.g. 127.0.0.1:9477 (disabled when empty)
 }
 
 // Config represents the top-level configuration
 type Config struct {
-	Hosts []HostConfig `yaml:"hosts"`
+	Hosts       []HostConfig      `yaml:"hosts"` // From every file, with defaults and templates applied
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	LogLevel    string            `yaml:"log_level"`  // debug, info (default), warn or error
+	LogFormat   string            `yaml:"log_format"` // text (default) or json
+	LogRotation LogRotationConfig `yaml:"log_rotation"`
+
+	// Defaults holds host settings applied to every host that doesn't set them itself.
+	// Templates are named host settings that hosts inherit with extends.
+	Defaults  yaml.Node            `yaml:"defaults"`
+	Templates map[string]yaml.Node `yaml:"templates"`
+
+	// Profiles are named sets of hosts, such as environments, added to Hosts when active.
+	// Profile names the active profile: the default from the file, or the one selected
+	// when loading.
+	Profile  string                   `yaml:"profile"`
+	Profiles map[string]ProfileConfig `yaml:"profiles"`
+
+	// JumpHostLimits caps connections across all forwards sharing a jump host, keyed by
+	// jump host name or "host:port"
+	JumpHostLimits map[string]ConnectionLimits `yaml:"jump_host_limits"`
+
+	// BandwidthLimit caps throughput across every forwarded connection
+	BandwidthLimit BandwidthLimit `yaml:"bandwidth_limit"`
+
+	// DrainTimeout is how long stopping waits for open connections before closing them
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+
+	// Hooks are commands to run on events for every host
+	Hooks HooksConfig `yaml:"hooks"`
+}
+
+// ByteSize is a number of bytes that can be written in YAML as an int (1048576) or
+// with a unit suffix ("1MB", "512KiB"); KB/MB/GB and KiB/MiB/GiB are both powers of 1024
+type ByteSize int64
+
+// UnmarshalYAML parses a ByteSize from an int or a string with a unit suffix
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	size, err := parseByteSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// parseByteSize converts "10MB"-style strings into a number of bytes
+func parseByteSize(input string) (ByteSize, error) {
+	s := strings.TrimSpace(input)
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+
+	upper := strings.ToUpper(s)
+	scale := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(upper, unit.suffix) {
+			scale = unit.scale
+			s = strings.TrimSpace(s[:len(s)-len(unit.suffix)])
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 || math.IsNaN(value) {
+		return 0, fmt.Errorf("invalid size %q: expected a number of bytes or a value like \"10MB\"", input)
+	}
+	size := value * float64(scale)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", input)
+	}
+	return ByteSize(size), nil
 }
 
 // ForwardConfig contains all parameters needed for a single forward connection
 type ForwardConfig struct {
-	LocalIP       string
-	RemoteHost    string
-	Port          int // Port to forward to on remote host
-	ListenPort    int // Port to listen on locally (may differ if using pf redirect)
-	JumpHost      string
-	JumpPort      int
-	KeyPath       string
-	IdentityAgent string
+	Name             string // Name of the HostConfig this forward belongs to
+	Host             string // hostKey of the HostConfig this forward belongs to
+	LocalIP          string
+	RemoteHost       string
+	Port             int // Port to forward to on remote host
+	ListenPort       int // Port to listen on locally (may differ if using pf redirect)
+	JumpHost         string
+	JumpPort         int
+	KeyPath          string
+	IdentityAgent    string
+	KeyPassphrase    string      // Secret reference, resolved when the key is loaded
+	Password         string      // Secret reference, resolved when the jump host asks
+	RemoteSocket     string      // Unix socket to dial on the jump host (overrides RemoteHost:Port)
+	ListenSocket     string      // Unix socket to listen on locally (overrides LocalIP:ListenPort)
+	SocketMode       os.FileMode // Permissions for ListenSocket
+	AccessLog        bool
+	IdentifyClients  bool     // Resolve the client process (implied by AllowedProcesses)
+	AllowedProcesses []string // Executables allowed to connect; empty allows all
+	Limits           ConnectionLimits
+}
+
+// isEnabled reports whether the config enables the host, which it does unless enabled is false
+func (h HostConfig) isEnabled() bool {
+	return h.Enabled == nil || *h.Enabled
+}
+
+// describe names a host and the files that define it, for error messages
+func (h HostConfig) describe() string {
+	if h.Source == "" {
+		return h.Name
+	}
+	return fmt.Sprintf("%s (%s)", h.Name, h.Source)
+}
+
+// hostKey identifies a host at runtime: its local IP, or its local socket for socket-only hosts
+func hostKey(host HostConfig) string {
+	if host.LocalIP != "" {
+		return host.LocalIP
+	}
+	return host.LocalSocket
 }
 
 // NewForwardConfig creates a ForwardConfig from a HostConfig and port
@@ -53,20 +191,86 @@ func NewForwardConfig(host HostConfig, port int) ForwardConfig {
 	}
 
 	return ForwardConfig{
-		LocalIP:       host.LocalIP,
-		RemoteHost:    host.RemoteHost,
-		Port:          port,
-		ListenPort:    listenPort,
-		JumpHost:      host.JumpHost,
-		JumpPort:      host.JumpPort,
-		KeyPath:       host.KeyPath,
-		IdentityAgent: host.IdentityAgent,
+		Name:             host.Name,
+		Host:             hostKey(host),
+		LocalIP:          host.LocalIP,
+		RemoteHost:       host.RemoteHost,
+		Port:             port,
+		ListenPort:       listenPort,
+		JumpHost:         host.JumpHost,
+		JumpPort:         host.JumpPort,
+		KeyPath:          host.KeyPath,
+		IdentityAgent:    host.IdentityAgent,
+		KeyPassphrase:    host.KeyPassphrase,
+		Password:         host.Password,
+		RemoteSocket:     host.RemoteSocket,
+		AccessLog:        host.AccessLog,
+		IdentifyClients:  host.IdentifyClients || len(host.AllowedProcesses) > 0,
+		AllowedProcesses: host.AllowedProcesses,
+		Limits:           host.Limits,
+	}
+}
+
+// NewSocketForwardConfig creates a ForwardConfig that exposes a host's remote_socket on its local_socket
+func NewSocketForwardConfig(host HostConfig) ForwardConfig {
+	return ForwardConfig{
+		Name:             host.Name,
+		Host:             hostKey(host),
+		LocalIP:          host.LocalIP,
+		RemoteHost:       host.RemoteHost,
+		JumpHost:         host.JumpHost,
+		JumpPort:         host.JumpPort,
+		KeyPath:          host.KeyPath,
+		IdentityAgent:    host.IdentityAgent,
+		KeyPassphrase:    host.KeyPassphrase,
+		Password:         host.Password,
+		RemoteSocket:     host.RemoteSocket,
+		ListenSocket:     host.LocalSocket,
+		SocketMode:       DefaultSocketMode,
+		AccessLog:        host.AccessLog,
+		IdentifyClients:  host.IdentifyClients || len(host.AllowedProcesses) > 0,
+		AllowedProcesses: host.AllowedProcesses,
+		Limits:           host.Limits,
+	}
+}
+
+// sshAuth returns the settings used to authenticate to the forward's jump host
+func (fc ForwardConfig) sshAuth() SSHAuth {
+	return SSHAuth{
+		KeyPath:       fc.KeyPath,
+		IdentityAgent: fc.IdentityAgent,
+		KeyPassphrase: fc.KeyPassphrase,
+		Password:      fc.Password,
 	}
 }
 
 // NeedsPFRedirect returns true if this config requires a pf redirect
 func (fc ForwardConfig) NeedsPFRedirect() bool {
-	return fc.Port != fc.ListenPort
+	return fc.ListenSocket == "" && fc.Port != fc.ListenPort
+}
+
+// ListenAddr returns the network and address to listen on locally
+func (fc ForwardConfig) ListenAddr() (string, string) {
+	if fc.ListenSocket != "" {
+		return "unix", fc.ListenSocket
+	}
+	return "tcp", fmt.Sprintf("%s:%d", fc.LocalIP, fc.ListenPort)
+}
+
+// LocalAddr returns the address clients connect to: local_ip:port, or the socket path
+func (fc ForwardConfig) LocalAddr() string {
+	if fc.ListenSocket != "" {
+		return fc.ListenSocket
+	}
+	return fmt.Sprintf("%s:%d", fc.LocalIP, fc.Port)
+}
+
+// RemoteAddr returns the network and address to dial through the jump host
+func (fc ForwardConfig) RemoteAddr() (string, string) {
+	if fc.RemoteSocket != "" {
+		return "unix", fc.RemoteSocket
+	}
+	return "tcp", fmt.Sprintf("%s:%d", fc.RemoteHost, fc.Port)
 }
 
 // isIPAddress returns true if the string is a valid IP address
@@ -74,19 +278,45 @@ func isIPAddress(s string) bool {
 	return net.ParseIP(s) != nil
 }
 
-// LoadConfig reads and parses a YAML configuration file
+// LoadConfig reads and parses a YAML configuration file, using the config's default profile
 func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	return LoadConfigProfile(path, "")
+}
+
+// LoadConfigProfile reads and parses a YAML configuration file, along with the files it
+// includes and those in the conf.d directory next to it, with the given profile's hosts
+// added to the shared ones. An empty profile selects the config's default profile.
+func LoadConfigProfile(path, profile string) (*Config, error) {
+	doc, err := loadConfigDocument(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := doc.settingsNode().Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	// Problems are collected rather than returned one at a time, so all of them can be fixed at once
+	errs := doc.problems
+
+	// Hosts are decoded from their nodes, on top of the settings they inherit
+	config.Hosts, err = config.resolveHosts(doc.hosts, &yaml.Node{})
+	errs = append(errs, err)
+
+	if err := config.applyProfile(profile, doc); errors.Is(err, ErrUnknownProfile) {
+		return nil, err
+	} else {
+		errs = append(errs, err)
+	}
+
 	// Set defaults
+	takenNames := make(map[string]bool, len(config.Hosts))
+	for _, host := range config.Hosts {
+		if host.Name != "" {
+			takenNames[host.Name] = true
+		}
+	}
 	for i := range config.Hosts {
 		if config.Hosts[i].JumpPort == 0 {
 			config.Hosts[i].JumpPort = SSHDefaultPort
@@ -95,46 +325,191 @@ func LoadConfig(path string) (*Config, error) {
 			config.Hosts[i].KeyPath = DefaultKeyPath
 		}
 		// Default hostnames to remote_host if remote_host is a domain name (not an IP)
-		if len(config.Hosts[i].Hostnames) == 0 {
+		if len(config.Hosts[i].Hostnames) == 0 && config.Hosts[i].RemoteHost != "" {
 			if isIPAddress(config.Hosts[i].RemoteHost) {
-				log.Printf("Warning: Host with remote_host=%s has no hostnames. Access via local IP %s only.",
-					config.Hosts[i].RemoteHost, config.Hosts[i].LocalIP)
+				slog.Warn("Host has no hostnames, access via local IP only",
+					"host", config.Hosts[i].RemoteHost, "local_ip", config.Hosts[i].LocalIP)
 			} else {
 				config.Hosts[i].Hostnames = []string{config.Hosts[i].RemoteHost}
 			}
 		}
+		if config.Hosts[i].Name == "" {
+			config.Hosts[i].Name = defaultHostName(config.Hosts[i], takenNames)
+		}
 	}
 
-	// Validate no port conflicts on same IP
-	if err := validatePortConflicts(&config); err != nil {
+	if config.DrainTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid drain_timeout: must not be negative"))
+	}
+	if config.DrainTimeout == 0 {
+		config.DrainTimeout = DefaultDrainTimeout
+	}
+
+	if _, err := newLogHandler(io.Discard, config.LogLevel, config.LogFormat); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs,
+		config.LogRotation.validate(),
+		validateMetricsConfig(config.Metrics),
+		validateHosts(&config),
+		validateHostNames(&config),
+		validateSocketForwards(&config),
+		validateForwardingOptions(&config),
+		validatePortConflicts(&config),
+	)
+	if err := errors.Join(errs...); err != nil {
 		return nil, err
 	}
 
 	return &config, nil
 }
 
+// defaultHostName names a host after its first hostname, else its local IP or socket. A name
+// that's already taken gets a numeric suffix, as import does (db, db-2, ...).
+func defaultHostName(host HostConfig, taken map[string]bool) string {
+	base := hostKey(host)
+	if len(host.Hostnames) > 0 {
+		base = host.Hostnames[0]
+	}
+	if base == "" {
+		return ""
+	}
+	name := base
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	taken[name] = true
+	return name
+}
+
+// validateHostNames ensures every host has a unique name, since names identify hosts at runtime.
+// Default names are made unique, so only explicit names can collide.
+func validateHostNames(config *Config) error {
+	var errs []error
+	seen := make(map[string]HostConfig, len(config.Hosts))
+	for _, host := range config.Hosts {
+		if host.Name == "" {
+			errs = append(errs, hostError(host, fmt.Errorf("no name: set name, hostnames or local_ip")))
+			continue
+		}
+		if existing, exists := seen[host.Name]; exists {
+			errs = append(errs, fmt.Errorf("duplicate host name %q at %s and %s",
+				host.Name, existing.Source, host.Source))
+			continue
+		}
+		seen[host.Name] = host
+	}
+	return errors.Join(errs...)
+}
+
+// validateForwardingOptions checks connection limits, bandwidth limits, fault injection and hook settings
+func validateForwardingOptions(config *Config) error {
+	var errs []error
+	for _, host := range config.Hosts {
+		for _, err := range []error{
+			host.Limits.validate("limits"),
+			host.BandwidthLimit.validate("bandwidth_limit"),
+			host.Faults.validate("faults"),
+			host.Hooks.validate("hooks"),
+		} {
+			if err != nil {
+				errs = append(errs, hostError(host, err))
+			}
+		}
+	}
+	errs = append(errs, config.BandwidthLimit.validate("bandwidth_limit"), config.Hooks.validate("hooks"))
+	for jumpHost, limits := range config.JumpHostLimits {
+		errs = append(errs, limits.validate("jump_host_limits."+jumpHost))
+	}
+	return errors.Join(errs...)
+}
+
+// validateMetricsConfig ensures the metrics endpoint is only ever exposed on loopback
+func validateMetricsConfig(metrics MetricsConfig) error {
+	if metrics.Listen == "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(metrics.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid metrics listen address %q: %w", metrics.Listen, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("invalid metrics listen address %q: only loopback addresses are allowed", metrics.Listen)
+	}
+
+	return nil
+}
+
+// validateSocketForwards checks that local sockets are used consistently and never shared
+func validateSocketForwards(config *Config) error {
+	var errs []error
+	sockets := make(map[string]HostConfig)
+
+	for _, host := range config.Hosts {
+		if host.LocalSocket != "" && host.RemoteSocket == "" {
+			errs = append(errs, hostError(host, fmt.Errorf("local_socket %s requires remote_socket to be set", host.LocalSocket)))
+			continue
+		}
+
+		// Invalid ports are reported by validateHosts
+		forwards, err := ExpandForwards(host)
+		if err != nil {
+			continue
+		}
+
+		for _, fwdCfg := range forwards {
+			if fwdCfg.ListenSocket == "" {
+				continue
+			}
+			// Relative paths live in the runtime dir, so compare where the sockets end up
+			path, err := resolveSocketPath(fwdCfg.ListenSocket)
+			if err != nil {
+				path = fwdCfg.ListenSocket
+			}
+			if existing, exists := sockets[path]; exists {
+				errs = append(errs, fmt.Errorf("socket conflict: %s is used by both %s and %s",
+					path, existing.describe(), host.describe()))
+				continue
+			}
+			sockets[path] = host
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // validatePortConflicts checks for port conflicts across hosts sharing the same local_ip
 func validatePortConflicts(config *Config) error {
-	// Map of "ip:port" -> remote_host for error messages
-	portMap := make(map[string]string)
+	var errs []error
+	// Map of "ip:port" -> host for error messages
+	portMap := make(map[string]HostConfig)
 
 	for _, host := range config.Hosts {
+		// Invalid ports are reported by validateHosts
 		ports, err := ExpandPorts(host)
 		if err != nil {
-			return err
+			continue
 		}
 
 		for _, port := range ports {
 			key := fmt.Sprintf("%s:%d", host.LocalIP, port)
 			if existingHost, exists := portMap[key]; exists {
-				return fmt.Errorf("port conflict: %s is used by both %s and %s",
-					key, existingHost, host.RemoteHost)
+				errs = append(errs, fmt.Errorf("port conflict: %s is used by both %s and %s",
+					key, existingHost.describe(), host.describe()))
+				continue
 			}
-			portMap[key] = host.RemoteHost
+			portMap[key] = host
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // FindConfigPath searches for a config file in:
@@ -157,14 +532,28 @@ func FindConfigPath() (string, error) {
 	return "", fmt.Errorf("no config file found. Searched:\n  - %s (current directory)\n  - %s (global config)", DefaultConfigPath, GlobalConfigPath)
 }
 
-// ExpandPorts converts port specifications (ints or "start-end" ranges) into a flat list
-func ExpandPorts(config HostConfig) ([]int, error) {
-	portsMap := make(map[int]bool)
+// PortSpec describes a single forwarded port and how it is exposed locally
+type PortSpec struct {
+	Port         int
+	ListenSocket string      // Expose on a local Unix socket instead of local_ip:port
+	SocketMode   os.FileMode // Permissions applied to ListenSocket
+}
+
+// DefaultSocketMode is applied to local sockets that don't set socket_mode
+const DefaultSocketMode os.FileMode = 0600
+
+// ExpandPortSpecs converts port specifications (ints, "start-end" ranges or
+// {port, listen_socket, socket_mode} mappings) into a sorted, deduplicated list
+func ExpandPortSpecs(config HostConfig) ([]PortSpec, error) {
+	specsMap := make(map[PortSpec]bool)
 
 	for _, portSpec := range config.Ports {
 		switch v := portSpec.(type) {
 		case int:
-			portsMap[v] = true
+			if err := validatePort(v); err != nil {
+				return nil, err
+			}
+			specsMap[PortSpec{Port: v}] = true
 		case string:
 			var start, end int
 			n, err := fmt.Sscanf(v, "%d-%d", &start, &end)
@@ -174,18 +563,150 @@ func ExpandPorts(config HostConfig) ([]int, error) {
 			if start > end {
 				return nil, fmt.Errorf("invalid port range %q: start (%d) must be <= end (%d)", v, start, end)
 			}
+			if validatePort(start) != nil || validatePort(end) != nil {
+				return nil, fmt.Errorf("invalid port range %q: ports must be between 1 and 65535", v)
+			}
 			for port := start; port <= end; port++ {
-				portsMap[port] = true
+				specsMap[PortSpec{Port: port}] = true
 			}
+		case map[string]interface{}:
+			spec, err := parsePortMapping(v)
+			if err != nil {
+				return nil, err
+			}
+			specsMap[spec] = true
 		default:
-			return nil, fmt.Errorf("invalid port specification: must be int or string range, got %T", v)
+			return nil, fmt.Errorf("invalid port specification: must be int, string range or mapping, got %T", v)
 		}
 	}
 
-	ports := make([]int, 0, len(portsMap))
-	for port := range portsMap {
-		ports = append(ports, port)
+	specs := make([]PortSpec, 0, len(specsMap))
+	for spec := range specsMap {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		if specs[i].Port != specs[j].Port {
+			return specs[i].Port < specs[j].Port
+		}
+		return specs[i].ListenSocket < specs[j].ListenSocket
+	})
+
+	return specs, nil
+}
+
+// validatePort checks that a port is in the valid TCP range
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d: must be between 1 and 65535", port)
+	}
+	return nil
+}
+
+// parsePortMapping parses a {port, listen_socket, socket_mode} port entry
+func parsePortMapping(m map[string]interface{}) (PortSpec, error) {
+	spec := PortSpec{}
+
+	for key, value := range m {
+		switch key {
+		case "port":
+			port, ok := value.(int)
+			if !ok {
+				return spec, fmt.Errorf("invalid port mapping: port must be an int, got %T", value)
+			}
+			spec.Port = port
+		case "listen_socket":
+			path, ok := value.(string)
+			if !ok || path == "" {
+				return spec, fmt.Errorf("invalid port mapping: listen_socket must be a non-empty string")
+			}
+			spec.ListenSocket = path
+		case "socket_mode":
+			mode, err := parseSocketMode(value)
+			if err != nil {
+				return spec, err
+			}
+			spec.SocketMode = mode
+		default:
+			return spec, fmt.Errorf("invalid port mapping: unknown key %q", key)
+		}
+	}
+
+	if spec.Port == 0 {
+		return spec, fmt.Errorf("invalid port mapping: port is required")
+	}
+	if err := validatePort(spec.Port); err != nil {
+		return spec, fmt.Errorf("invalid port mapping: %w", err)
+	}
+	if spec.SocketMode != 0 && spec.ListenSocket == "" {
+		return spec, fmt.Errorf("invalid port mapping for port %d: socket_mode requires listen_socket", spec.Port)
+	}
+	if spec.ListenSocket != "" && spec.SocketMode == 0 {
+		spec.SocketMode = DefaultSocketMode
+	}
+
+	return spec, nil
+}
+
+// parseSocketMode accepts octal strings ("0660") or ints decoded by YAML (0660)
+func parseSocketMode(value interface{}) (os.FileMode, error) {
+	switch v := value.(type) {
+	case int:
+		if v <= 0 || v > 0777 {
+			return 0, fmt.Errorf("invalid socket_mode %o: must be between 0001 and 0777", v)
+		}
+		return os.FileMode(v), nil
+	case string:
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || mode == 0 || mode > 0777 {
+			return 0, fmt.Errorf("invalid socket_mode %q: must be an octal permission like \"0660\"", v)
+		}
+		return os.FileMode(mode), nil
+	default:
+		return 0, fmt.Errorf("invalid socket_mode: must be an octal string or int, got %T", v)
+	}
+}
+
+// ExpandPorts returns the flat list of ports that listen on local_ip (socket-exposed ports are excluded)
+func ExpandPorts(config HostConfig) ([]int, error) {
+	specs, err := ExpandPortSpecs(config)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	ports := make([]int, 0, len(specs))
+	for _, spec := range specs {
+		if spec.ListenSocket != "" || seen[spec.Port] {
+			continue
+		}
+		seen[spec.Port] = true
+		ports = append(ports, spec.Port)
 	}
 
 	return ports, nil
 }
+
+// ExpandForwards builds every ForwardConfig for a host: one per port spec plus
+// the local_socket forward for remote_socket hosts
+func ExpandForwards(host HostConfig) ([]ForwardConfig, error) {
+	specs, err := ExpandPortSpecs(host)
+	if err != nil {
+		return nil, err
+	}
+
+	forwards := make([]ForwardConfig, 0, len(specs)+1)
+	for _, spec := range specs {
+		fwdCfg := NewForwardConfig(host, spec.Port)
+		if spec.ListenSocket != "" {
+			fwdCfg.ListenSocket = spec.ListenSocket
+			fwdCfg.SocketMode = spec.SocketMode
+		}
+		forwards = append(forwards, fwdCfg)
+	}
+
+	if host.LocalSocket != "" {
+		forwards = append(forwards, NewSocketForwardConfig(host))
+	}
+
+	return forwards, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -59,6 +60,27 @@ func TestExpandPorts(t *testing.T) {
 			},
 			shouldErr: true,
 		},
+		{
+			name: "port zero",
+			config: HostConfig{
+				Ports: []interface{}{0},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "port above 65535",
+			config: HostConfig{
+				Ports: []interface{}{65536},
+			},
+			shouldErr: true,
+		},
+		{
+			name: "range above 65535",
+			config: HostConfig{
+				Ports: []interface{}{"65530-65540"},
+			},
+			shouldErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -328,3 +350,291 @@ func TestLoadConfigHostnameDefaulting(t *testing.T) {
 		})
 	}
 }
+
+func TestForwardConfigAddrs(t *testing.T) {
+	host := HostConfig{
+		LocalIP:    "127.0.0.2",
+		RemoteHost: "remote.example.com",
+		JumpHost:   "jump.example.com",
+		JumpPort:   22,
+	}
+
+	network, addr := NewForwardConfig(host, 80).RemoteAddr()
+	if network != "tcp" || addr != "remote.example.com:80" {
+		t.Errorf("RemoteAddr() = %s %s, want tcp remote.example.com:80", network, addr)
+	}
+
+	network, addr = NewForwardConfig(host, 80).ListenAddr()
+	if network != "tcp" || addr != "127.0.0.2:10080" {
+		t.Errorf("ListenAddr() = %s %s, want tcp 127.0.0.2:10080", network, addr)
+	}
+
+	host.RemoteSocket = "/var/run/docker.sock"
+	network, addr = NewForwardConfig(host, 2375).RemoteAddr()
+	if network != "unix" || addr != "/var/run/docker.sock" {
+		t.Errorf("RemoteAddr() = %s %s, want unix /var/run/docker.sock", network, addr)
+	}
+
+	host.LocalSocket = "/tmp/docker.sock"
+	cfg := NewSocketForwardConfig(host)
+	network, addr = cfg.ListenAddr()
+	if network != "unix" || addr != "/tmp/docker.sock" {
+		t.Errorf("ListenAddr() = %s %s, want unix /tmp/docker.sock", network, addr)
+	}
+	if cfg.NeedsPFRedirect() {
+		t.Error("NeedsPFRedirect() = true for socket forward, want false")
+	}
+}
+
+func TestLoadConfigRemoteSocket(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		shouldErr     bool
+	}{
+		{
+			name: "remote socket on tcp port",
+			configContent: `hosts:
+  - local_ip: 127.0.0.2
+    jump_host: docker.example.com
+    remote_socket: /var/run/docker.sock
+    ports: [2375]
+`,
+		},
+		{
+			name: "remote socket on local socket",
+			configContent: `hosts:
+  - jump_host: docker.example.com
+    remote_socket: /var/run/docker.sock
+    local_socket: /tmp/docker.sock
+`,
+		},
+		{
+			name: "local socket without remote socket",
+			configContent: `hosts:
+  - local_ip: 127.0.0.2
+    remote_host: db.example.com
+    jump_host: bastion.example.com
+    local_socket: /tmp/db.sock
+`,
+			shouldErr: true,
+		},
+		{
+			name: "duplicate local socket",
+			configContent: `hosts:
+  - jump_host: a.example.com
+    remote_socket: /var/run/docker.sock
+    local_socket: /tmp/docker.sock
+  - jump_host: b.example.com
+    remote_socket: /var/run/docker.sock
+    local_socket: /tmp/docker.sock
+`,
+			shouldErr: true,
+		},
+		{
+			name: "same local socket given relative and absolute",
+			configContent: `hosts:
+  - name: a
+    jump_host: a.example.com
+    remote_socket: /var/run/docker.sock
+    local_socket: docker.sock
+  - name: b
+    jump_host: b.example.com
+    remote_socket: /var/run/docker.sock
+    local_socket: /run/user/test/portsmith/docker.sock
+`,
+			shouldErr: true,
+		},
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "portsmith-test-socket-*.yaml")
+			if err != nil {
+				t.Fatalf("Failed to create temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+
+			if _, err := tmpFile.Write([]byte(tt.configContent)); err != nil {
+				t.Fatalf("Failed to write temp file: %v", err)
+			}
+			tmpFile.Close()
+
+			config, err := LoadConfig(tmpFile.Name())
+			if tt.shouldErr {
+				if err == nil {
+					t.Error("LoadConfig() expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if len(config.Hosts[0].Hostnames) != 0 {
+				t.Errorf("Hostnames = %v, want none for socket-only host", config.Hosts[0].Hostnames)
+			}
+		})
+	}
+}
+
+func TestExpandPortSpecs(t *testing.T) {
+	host := HostConfig{
+		LocalIP: "127.0.0.2",
+		Ports: []interface{}{
+			80,
+			map[string]interface{}{"port": 5432, "listen_socket": "postgres.sock"},
+			map[string]interface{}{"port": 6379, "listen_socket": "/tmp/redis.sock", "socket_mode": "0660"},
+		},
+	}
+
+	specs, err := ExpandPortSpecs(host)
+	if err != nil {
+		t.Fatalf("ExpandPortSpecs() error = %v", err)
+	}
+	if len(specs) != 3 {
+		t.Fatalf("ExpandPortSpecs() returned %d specs, expected 3", len(specs))
+	}
+	if specs[1].ListenSocket != "postgres.sock" || specs[1].SocketMode != DefaultSocketMode {
+		t.Errorf("specs[1] = %+v, want postgres.sock with default mode", specs[1])
+	}
+	if specs[2].SocketMode != 0660 {
+		t.Errorf("specs[2].SocketMode = %o, want 660", specs[2].SocketMode)
+	}
+
+	ports, err := ExpandPorts(host)
+	if err != nil {
+		t.Fatalf("ExpandPorts() error = %v", err)
+	}
+	if len(ports) != 1 || ports[0] != 80 {
+		t.Errorf("ExpandPorts() = %v, want [80] (socket ports excluded)", ports)
+	}
+
+	forwards, err := ExpandForwards(host)
+	if err != nil {
+		t.Fatalf("ExpandForwards() error = %v", err)
+	}
+	network, addr := forwards[1].ListenAddr()
+	if network != "unix" || addr != "postgres.sock" {
+		t.Errorf("ListenAddr() = %s %s, want unix postgres.sock", network, addr)
+	}
+	if forwards[1].NeedsPFRedirect() {
+		t.Error("NeedsPFRedirect() = true for socket forward, want false")
+	}
+}
+
+func TestExpandPortSpecsInvalidMapping(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"listen_socket": "missing-port.sock"},
+		{"port": 80, "socket_mode": "0660"},
+		{"port": 80, "listen_socket": "a.sock", "socket_mode": "999"},
+		{"port": 80, "listen_sock": "typo.sock"},
+	}
+
+	for _, mapping := range tests {
+		_, err := ExpandPortSpecs(HostConfig{Ports: []interface{}{mapping}})
+		if err == nil {
+			t.Errorf("ExpandPortSpecs(%v) expected error, got none", mapping)
+		}
+	}
+}
+
+func TestLoadConfigHostNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantNames     []string
+		shouldErr     bool
+	}{
+		{
+			name: "explicit name, first hostname, then local_ip",
+			configContent: `defaults: {jump_host: bastion.example.com}
+hosts:
+  - name: db
+    local_ip: 127.0.0.2
+    remote_host: db.example.com
+  - local_ip: 127.0.0.3
+    hostnames: [api.local, api.test]
+    remote_host: 10.0.0.5
+  - local_ip: 127.0.0.4
+    remote_host: 10.0.0.6
+`,
+			wantNames: []string{"db", "api.local", "127.0.0.4"},
+		},
+		{
+			name: "default names made unique",
+			configContent: `defaults: {jump_host: bastion.example.com}
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: 10.0.0.5
+    ports: [80]
+  - local_ip: 127.0.0.2
+    remote_host: 10.0.0.6
+    ports: [81]
+  - local_ip: 127.0.0.3
+    remote_host: db.example.com
+    ports: [5432]
+  - local_ip: 127.0.0.4
+    remote_host: db.example.com
+    ports: [5433]
+  - name: 127.0.0.2-2
+    local_ip: 127.0.0.5
+    remote_host: 10.0.0.7
+    ports: [82]
+`,
+			wantNames: []string{"127.0.0.2", "127.0.0.2-3", "db.example.com", "db.example.com-2", "127.0.0.2-2"},
+		},
+		{
+			name: "duplicate explicit names",
+			configContent: `defaults: {jump_host: bastion.example.com}
+hosts:
+  - name: web
+    local_ip: 127.0.0.2
+    remote_host: 10.0.0.5
+    ports: [80]
+  - name: web
+    local_ip: 127.0.0.3
+    remote_host: 10.0.0.6
+    ports: [81]
+`,
+			shouldErr: true,
+		},
+		{
+			name: "names tell hosts on the same IP apart",
+			configContent: `defaults: {jump_host: bastion.example.com}
+hosts:
+  - name: web
+    local_ip: 127.0.0.2
+    remote_host: 10.0.0.5
+    ports: [80]
+  - name: admin
+    local_ip: 127.0.0.2
+    remote_host: 10.0.0.6
+    ports: [81]
+`,
+			wantNames: []string{"web", "admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.configContent), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			config, err := LoadConfig(path)
+			if (err != nil) != tt.shouldErr {
+				t.Fatalf("LoadConfig() error = %v, shouldErr %v", err, tt.shouldErr)
+			}
+			if err != nil {
+				return
+			}
+			for i, want := range tt.wantNames {
+				if got := config.Hosts[i].Name; got != want {
+					t.Errorf("Hosts[%d].Name = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies what happened in an Event
+type EventType string
+
+const (
+	EventForwardStarted   EventType = "forward_started"
+	EventForwardStopped   EventType = "forward_stopped"
+	EventConnectionOpened EventType = "connection_opened"
+	EventConnectionClosed EventType = "connection_closed"
+	EventSSHConnected     EventType = "ssh_connected"
+	EventSSHDisconnected  EventType = "ssh_disconnected"
+	EventAuthNeeded       EventType = "auth_needed"
+	EventError            EventType = "error"
+	EventConfigReloaded   EventType = "config_reloaded"
+	EventStatus           EventType = "status" // Overall health changed
+)
+
+// DefaultEventBuffer is how many undelivered events a subscription holds before dropping the oldest
+const DefaultEventBuffer = 1024
+
+// Event describes a forwarder state change. Fields that don't apply to the event type are empty.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Name     string // Name of the host the forward belongs to
+	Host     string // Host the forward belongs to (local IP, or local socket for socket-only hosts)
+	Port     int    // Remote port of the forward (0 for socket forwards)
+	Listen   string // Local address or socket path of the forward
+	Remote   string // Remote address or socket dialed through the jump host
+	JumpHost string // Jump host as host:port
+	ConnID   uint64
+	Client   string
+	Duration time.Duration // How long the connection was open
+	BytesIn  int64
+	BytesOut int64
+	Reason   string       // Close reason for connection_closed
+	Health   HealthStatus // For status events
+	Message  string
+	Err      error
+}
+
+// EventBus fans events out to independent subscribers. Publishing never blocks: each
+// subscription queues events for its reader and drops the oldest (counting them) if the
+// reader falls too far behind. The zero value is ready to use.
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives events in publish order on C until Close is called
+type Subscription struct {
+	C <-chan Event
+
+	bus   *EventBus
+	ch    chan Event
+	types map[EventType]bool // Empty means all types
+	limit int
+
+	mu      sync.Mutex
+	queue   []Event
+	dropped uint64
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Subscribe returns a subscription to the given event types, or to all events if none are given
+func (b *EventBus) Subscribe(types ...EventType) *Subscription {
+	ch := make(chan Event)
+	sub := &Subscription{
+		C:     ch,
+		bus:   b,
+		ch:    ch,
+		types: make(map[EventType]bool, len(types)),
+		limit: DefaultEventBuffer,
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[*Subscription]struct{})
+	}
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go sub.deliver()
+	return sub
+}
+
+// Publish sends an event to every matching subscriber without blocking
+func (b *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if len(sub.types) == 0 || sub.types[event.Type] {
+			sub.enqueue(event)
+		}
+	}
+}
+
+// enqueue adds an event to the subscriber's queue, dropping the oldest if it is full
+func (s *Subscription) enqueue(event Event) {
+	s.mu.Lock()
+	if len(s.queue) >= s.limit {
+		s.queue = s.queue[1:]
+		s.dropped++
+	}
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver moves queued events to C until the subscription is closed
+func (s *Subscription) deliver() {
+	defer close(s.ch)
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Dropped returns how many events were discarded because the reader fell behind
+func (s *Subscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// Close stops delivery and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.done)
+	})
+}
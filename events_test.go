@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// receiveEvent waits for the next event on a subscription
+func receiveEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed unexpectedly")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestEventBusDelivery(t *testing.T) {
+	var bus EventBus
+	connections := bus.Subscribe(EventConnectionOpened, EventConnectionClosed)
+	defer connections.Close()
+	all := bus.Subscribe()
+	defer all.Close()
+
+	bus.Publish(Event{Type: EventConnectionOpened, ConnID: 1})
+	bus.Publish(Event{Type: EventSSHConnected, JumpHost: "bastion:22"})
+	bus.Publish(Event{Type: EventConnectionClosed, ConnID: 1})
+
+	for _, want := range []EventType{EventConnectionOpened, EventConnectionClosed} {
+		if event := receiveEvent(t, connections); event.Type != want {
+			t.Errorf("filtered subscriber got %s, want %s", event.Type, want)
+		}
+	}
+	for _, want := range []EventType{EventConnectionOpened, EventSSHConnected, EventConnectionClosed} {
+		event := receiveEvent(t, all)
+		if event.Type != want {
+			t.Errorf("subscriber got %s, want %s", event.Type, want)
+		}
+		if event.Time.IsZero() {
+			t.Error("Publish() should timestamp events")
+		}
+	}
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	var bus EventBus
+	slow := bus.Subscribe()
+	defer slow.Close()
+	errorsOnly := bus.Subscribe(EventError)
+	defer errorsOnly.Close()
+
+	// Publishing must not block even though nobody reads the slow subscription
+	total := DefaultEventBuffer + 10
+	start := time.Now()
+	for i := 0; i < total; i++ {
+		bus.Publish(Event{Type: EventConnectionOpened, ConnID: uint64(i)})
+	}
+	bus.Publish(Event{Type: EventError})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Publish() took %v, want it never to block on slow subscribers", elapsed)
+	}
+
+	// Other subscribers are unaffected
+	if event := receiveEvent(t, errorsOnly); event.Type != EventError {
+		t.Errorf("errors subscriber got %s, want %s", event.Type, EventError)
+	}
+	if dropped := errorsOnly.Dropped(); dropped != 0 {
+		t.Errorf("errors subscriber Dropped() = %d, want 0", dropped)
+	}
+
+	// The slow subscriber lost some of the oldest events, knows how many, and still gets the newest
+	received := 0
+	for {
+		received++
+		if receiveEvent(t, slow).Type == EventError {
+			break
+		}
+	}
+	dropped := slow.Dropped()
+	if dropped == 0 {
+		t.Error("Dropped() = 0, want the overflow to be counted")
+	}
+	if received+int(dropped) != total+1 {
+		t.Errorf("received %d + dropped %d events, want %d in total", received, dropped, total+1)
+	}
+}
+
+func TestEventBusClose(t *testing.T) {
+	var bus EventBus
+	sub := bus.Subscribe()
+	bus.Publish(Event{Type: EventError, Err: fmt.Errorf("pending")})
+
+	sub.Close()
+	sub.Close()
+	for range sub.C {
+		// Drain anything delivered before Close
+	}
+
+	// Publishing after every subscriber closed is a no-op
+	bus.Publish(Event{Type: EventError})
+}
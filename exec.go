@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultExecReadyTimeout bounds how long exec waits for its hosts to listen and their jump
+// hosts to connect before giving up without running the command
+const DefaultExecReadyTimeout = 30 * time.Second
+
+// execEnvPrefix starts the names of the variables exec passes to its command
+const execEnvPrefix = "PORTSMITH_"
+
+// startExecHosts starts the hosts and waits until every one of their forwards is listening,
+// returning an error if any fails to listen or ctx ends first. Hosts already started are
+// left for the caller to stop.
+func startExecHosts(ctx context.Context, forwarder *DynamicForwarder, config *Config, hosts []HostConfig) error {
+	pending := make(map[string]bool)
+	for _, host := range hosts {
+		forwards, err := ExpandForwards(host)
+		if err != nil {
+			return hostError(host, err)
+		}
+		for _, forward := range forwards {
+			// Listen events carry the resolved socket path, as startHost listens on it
+			if forward.ListenSocket != "" {
+				if forward.ListenSocket, err = resolveSocketPath(forward.ListenSocket); err != nil {
+					return hostError(host, err)
+				}
+			}
+			_, listen := forward.ListenAddr()
+			pending[listen] = true
+		}
+	}
+
+	events := forwarder.Subscribe(EventForwardStarted, EventError)
+	defer events.Close()
+
+	if err := forwarder.StartHosts(config, hosts); err != nil {
+		return err
+	}
+
+	for len(pending) > 0 {
+		select {
+		case event := <-events.C:
+			if !pending[event.Listen] {
+				continue
+			}
+			if event.Type == EventError {
+				return fmt.Errorf("failed to listen on %s: %w", event.Listen, event.Err)
+			}
+			delete(pending, event.Listen)
+		case <-ctx.Done():
+			return fmt.Errorf("%d forward(s) not listening: %w", len(pending), ctx.Err())
+		}
+	}
+	return nil
+}
+
+// connectJumpHosts opens the SSH connection to each host's jump host, so that prompts for
+// passphrases or passwords happen before the command starts rather than in its output
+func (df *DynamicForwarder) connectJumpHosts(ctx context.Context, hosts []HostConfig) error {
+	for _, host := range hosts {
+		auth := NewForwardConfig(host, 0).sshAuth()
+		if _, err := df.sshPool.GetClient(ctx, host.JumpHost, host.JumpPort, auth); err != nil {
+			return hostError(host, fmt.Errorf("failed to connect to jump host %s: %w", host.JumpHost, err))
+		}
+	}
+	return nil
+}
+
+// execEnv returns the PORTSMITH_<NAME>_HOST, _PORT, _PORTS and _SOCKET variables for hosts
+func execEnv(hosts []HostConfig) ([]string, error) {
+	var env []string
+	for _, host := range hosts {
+		hostVars, err := hostEnv(host, execEnvPrefix)
+		if err != nil {
+			return nil, hostError(host, err)
+		}
+		env = append(env, hostVars...)
+	}
+	return env, nil
+}
+
+// runExecCommand runs a command with env added to portsmith's environment, relaying signals
+// to it, and returns its exit code. A command killed by a signal exits with 128 plus the
+// signal number, as in a shell; one that can't be started with 127.
+func runExecCommand(command []string, env []string, signals <-chan os.Signal) (int, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+
+	if err := cmd.Start(); err != nil {
+		return 127, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// runExec forwards the named hosts while a command runs: once every forward is listening
+// and the jump hosts are connected, the command runs with PORTSMITH_<NAME>_HOST and _PORT
+// variables, and the hosts are torn down when it exits. Its exit code is passed on.
+func runExec(args []string) int {
+	flags := flag.NewFlagSet("exec", flag.ExitOnError)
+	configFlag := flags.String("config", "", "config file (default: the one the tray app loads)")
+	profile := flags.String("profile", "", "profile the hosts are in (default: the last one selected, else the config's profile)")
+	names := flags.String("hosts", "", "comma-separated names of the hosts to forward (default: every enabled host)")
+	timeout := flags.Duration("timeout", DefaultExecReadyTimeout, "how long to wait for the hosts to be ready")
+	logLevel := flags.String("log-level", "warn", "log level for portsmith's own output on stderr")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: portsmith exec [--hosts db,api] [--profile name] [--config config.yaml] -- command [args...]")
+		fmt.Fprintln(flags.Output(), "\nForwards the hosts while the command runs, passing PORTSMITH_<NAME>_HOST and _PORT to it.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	command := flags.Args()
+	if len(command) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	path, err := commandConfigPath(*configFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	config, hosts, err := commandHosts(path, *profile, *names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	handler, err := newLogHandler(os.Stderr, *logLevel, config.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	slog.SetDefault(slog.New(handler))
+
+	env, err := execEnv(hosts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	forwarder, err := NewDynamicForwarder(path, *profile, hosts, findHelperPath())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Signals during startup abandon it; once the command runs they're passed on to it
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err = startExecHosts(ctx, forwarder, config, hosts)
+	if err == nil {
+		err = forwarder.connectJumpHosts(ctx, hosts)
+	}
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		forwarder.Close()
+		return 1
+	}
+
+	code, err := runExecCommand(command, env, signals)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	forwarder.Stop()
+	return code
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartExecHosts(t *testing.T) {
+	dir := t.TempDir()
+	port := freePort(t)
+	socket := filepath.Join(dir, "db.sock")
+	// 127.0.0.1 without hostnames needs no helper calls, so the hosts can run for real
+	blackhole := FaultConfig{Enabled: true, Blackhole: true}
+	hosts := []HostConfig{
+		{Name: "db", LocalIP: "127.0.0.1", RemoteHost: "db.invalid", JumpHost: "bastion.invalid", JumpPort: 22, Faults: blackhole,
+			Ports: []interface{}{port, map[string]interface{}{"port": 5432, "listen_socket": socket}}},
+	}
+	df := &DynamicForwarder{netSetup: &NetworkSetup{}, sshPool: NewSSHClientPool(), stats: NewStats()}
+	defer df.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := startExecHosts(ctx, df, &Config{}, hosts); err != nil {
+		t.Fatalf("startExecHosts() error = %v", err)
+	}
+
+	// Both forwards accept connections as soon as it returns
+	for _, addr := range []struct{ network, address string }{
+		{"tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))},
+		{"unix", socket},
+	} {
+		conn, err := net.Dial(addr.network, addr.address)
+		if err != nil {
+			t.Errorf("Dial(%s) error = %v", addr.address, err)
+			continue
+		}
+		conn.Close()
+	}
+
+	if err := df.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket still exists after Stop: %v", err)
+	}
+}
+
+func TestStartExecHostsListenFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	hosts := []HostConfig{
+		{Name: "db", LocalIP: "127.0.0.1", RemoteHost: "db.invalid", JumpHost: "bastion.invalid", JumpPort: 22, Ports: []interface{}{port}},
+	}
+	df := &DynamicForwarder{netSetup: &NetworkSetup{}, sshPool: NewSSHClientPool(), stats: NewStats()}
+	defer df.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = startExecHosts(ctx, df, &Config{}, hosts)
+	if err == nil || !strings.Contains(err.Error(), "failed to listen") {
+		t.Errorf("startExecHosts() error = %v, want a listen failure", err)
+	}
+}
+
+func TestRunExecCommand(t *testing.T) {
+	env, err := execEnv([]HostConfig{{Name: "db", LocalIP: "127.0.0.3", Ports: []interface{}{5432}}})
+	if err != nil {
+		t.Fatalf("execEnv() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		command  []string
+		wantCode int
+		wantErr  bool
+	}{
+		{"success", []string{"true"}, 0, false},
+		{"exit code passed on", []string{"sh", "-c", "exit 3"}, 3, false},
+		{"variables", []string{"sh", "-c", `test "$PORTSMITH_DB_HOST:$PORTSMITH_DB_PORT" = 127.0.0.3:5432`}, 0, false},
+		{"killed by a signal", []string{"sh", "-c", "kill -TERM $$"}, 128 + int(syscall.SIGTERM), false},
+		{"not found", []string{filepath.Join(t.TempDir(), "missing")}, 127, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := runExecCommand(tt.command, env, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRunExecCommandRelaysSignals(t *testing.T) {
+	ready := filepath.Join(t.TempDir(), "ready")
+	signals := make(chan os.Signal)
+	go func() {
+		// Signal only once the shell has set its trap
+		for i := 0; i < 500; i++ {
+			if _, err := os.Stat(ready); err == nil {
+				signals <- syscall.SIGTERM
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	// The shell exits 7 on the relayed signal rather than sleeping out the timeout
+	script := "trap 'kill $!; exit 7' TERM; touch " + ready + "; sleep 5 & wait"
+	code, err := runExecCommand([]string{"sh", "-c", script}, nil, signals)
+	if err != nil {
+		t.Fatalf("runExecCommand() error = %v", err)
+	}
+	if code != 7 {
+		t.Errorf("exit code = %d, want 7", code)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// exportFormats renders hosts for tools other than portsmith, keyed by --format name
+var exportFormats = map[string]func(w io.Writer, hosts []HostConfig, prefix string) error{
+	"ssh-cmd":    exportSSHCommands,
+	"ssh-config": exportSSHConfig,
+	"env":        exportEnv,
+}
+
+// sshForwardSpec is one forward as ssh describes it: where it listens locally and where it
+// connects to from the jump host, each a host:port or a Unix socket path
+type sshForwardSpec struct {
+	listen      string
+	destination string
+}
+
+// sshForwardSpecs returns the forwards of a host as ssh would set them up. ssh listens on
+// the real port rather than the unprivileged one portsmith redirects from.
+func sshForwardSpecs(host HostConfig) ([]sshForwardSpec, error) {
+	forwards, err := ExpandForwards(host)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]sshForwardSpec, 0, len(forwards))
+	for _, forward := range forwards {
+		var spec sshForwardSpec
+		if forward.ListenSocket != "" {
+			if spec.listen, err = resolveSocketPath(forward.ListenSocket); err != nil {
+				return nil, err
+			}
+		} else {
+			spec.listen = net.JoinHostPort(forward.LocalIP, strconv.Itoa(forward.Port))
+		}
+		if forward.RemoteSocket != "" {
+			spec.destination = forward.RemoteSocket
+		} else {
+			spec.destination = net.JoinHostPort(forward.RemoteHost, strconv.Itoa(forward.Port))
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// exportComment describes a host above its exported form: where it's defined and the
+// hostnames portsmith would add to /etc/hosts for it
+func exportComment(host HostConfig) string {
+	comment := "# " + host.describe()
+	if len(host.Hostnames) > 0 && host.LocalIP != "" {
+		comment += fmt.Sprintf("; /etc/hosts: %s %s", host.LocalIP, strings.Join(host.Hostnames, " "))
+	}
+	return comment
+}
+
+// exportSSHCommands writes an ssh command per host that holds its forwards open
+func exportSSHCommands(w io.Writer, hosts []HostConfig, _ string) error {
+	for i, host := range hosts {
+		specs, err := sshForwardSpecs(host)
+		if err != nil {
+			return hostError(host, err)
+		}
+
+		args := []string{"ssh", "-N", "-o", "ExitOnForwardFailure=yes"}
+		if host.JumpPort != SSHDefaultPort {
+			args = append(args, "-p", strconv.Itoa(host.JumpPort))
+		}
+		if host.KeyPath != DefaultKeyPath {
+			args = append(args, "-i", host.KeyPath)
+		}
+		if host.IdentityAgent != "" {
+			args = append(args, "-o", "IdentityAgent="+host.IdentityAgent)
+		}
+		for _, spec := range specs {
+			args = append(args, "-L", spec.listen+":"+spec.destination)
+		}
+		args = append(args, host.JumpHost)
+
+		for j, arg := range args {
+			args[j] = shellQuote(arg)
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, exportComment(host))
+		fmt.Fprintln(w, strings.Join(args, " "))
+	}
+	return nil
+}
+
+// exportSSHConfig writes a ~/.ssh/config Host block per host, named after it, so
+// `ssh -N <name>` holds its forwards open
+func exportSSHConfig(w io.Writer, hosts []HostConfig, _ string) error {
+	for i, host := range hosts {
+		specs, err := sshForwardSpecs(host)
+		if err != nil {
+			return hostError(host, err)
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, exportComment(host))
+		fmt.Fprintf(w, "Host %s\n", sshConfigQuote(host.Name))
+		fmt.Fprintf(w, "  HostName %s\n", host.JumpHost)
+		if host.JumpPort != SSHDefaultPort {
+			fmt.Fprintf(w, "  Port %d\n", host.JumpPort)
+		}
+		if host.KeyPath != DefaultKeyPath {
+			fmt.Fprintf(w, "  IdentityFile %s\n", sshConfigQuote(host.KeyPath))
+		}
+		if host.IdentityAgent != "" {
+			fmt.Fprintf(w, "  IdentityAgent %s\n", sshConfigQuote(host.IdentityAgent))
+		}
+		for _, spec := range specs {
+			fmt.Fprintf(w, "  LocalForward %s %s\n", sshConfigQuote(spec.listen), sshConfigQuote(spec.destination))
+		}
+		fmt.Fprintln(w, "  ExitOnForwardFailure yes")
+	}
+	return nil
+}
+
+// exportEnv writes shell export lines telling scripts where each host's forwards listen
+func exportEnv(w io.Writer, hosts []HostConfig, prefix string) error {
+	for _, host := range hosts {
+		env, err := hostEnv(host, prefix)
+		if err != nil {
+			return hostError(host, err)
+		}
+		if len(env) == 0 {
+			continue
+		}
+
+		for i, variable := range env {
+			name, value, _ := strings.Cut(variable, "=")
+			env[i] = name + "=" + shellQuote(value)
+		}
+		fmt.Fprintln(w, exportComment(host))
+		fmt.Fprintln(w, "export "+strings.Join(env, " "))
+	}
+	return nil
+}
+
+// hostEnv returns the NAME=value variables that tell a script where a host's forwards
+// listen, named after the host: <prefix><NAME>_HOST and _PORT for its local IP and first
+// port, _PORTS when it has more than one, and _SOCKET for its local socket
+func hostEnv(host HostConfig, prefix string) ([]string, error) {
+	ports, err := ExpandPorts(host)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := ExpandPortSpecs(host)
+	if err != nil {
+		return nil, err
+	}
+
+	name := prefix + hostEnvName(host.Name)
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	var env []string
+	if len(ports) > 0 {
+		env = append(env, name+"_HOST="+host.LocalIP, name+"_PORT="+strconv.Itoa(ports[0]))
+	}
+	if len(ports) > 1 {
+		list := make([]string, len(ports))
+		for i, port := range ports {
+			list[i] = strconv.Itoa(port)
+		}
+		env = append(env, name+"_PORTS="+strings.Join(list, " "))
+	}
+
+	socket := host.LocalSocket
+	for _, spec := range specs {
+		if socket == "" && spec.ListenSocket != "" {
+			socket = spec.ListenSocket
+		}
+	}
+	if socket != "" {
+		path, err := resolveSocketPath(socket)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, name+"_SOCKET="+path)
+	}
+	return env, nil
+}
+
+// hostEnvName converts a host name for use in a variable name: "db.local" becomes DB_LOCAL
+func hostEnvName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(name) {
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// shellQuote quotes s for a POSIX shell if it contains anything but safe characters. A
+// leading ~/ is left unquoted so the shell expands it.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.HasPrefix(s, "~/") && len(s) > 2 {
+		return "~/" + shellQuote(s[2:])
+	}
+	safe := true
+	for _, c := range s {
+		if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%", c) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sshConfigQuote double-quotes an ssh config argument containing whitespace
+func sshConfigQuote(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// runExport prints the hosts that portsmith would forward as ssh commands, ~/.ssh/config
+// Host blocks or shell variables, so the same tunnels can be set up without portsmith
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "ssh-cmd", "output format: ssh-cmd, ssh-config or env")
+	configFlag := flags.String("config", "", "config file (default: the one the tray app loads)")
+	profile := flags.String("profile", "", "profile to export (default: the last one selected, else the config's profile)")
+	names := flags.String("hosts", "", "comma-separated names of the hosts to export (default: every enabled host)")
+	prefix := flags.String("prefix", "", "prefix for the variable names of the env format, e.g. PORTSMITH_")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: portsmith export [--format ssh-cmd|ssh-config|env] [--hosts db,api] [--profile name] [--config config.yaml]")
+		fmt.Fprintln(flags.Output(), "\nPrints the hosts as equivalent ssh -L commands, ~/.ssh/config Host blocks or shell variables.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	export, exists := exportFormats[*format]
+	if !exists || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	path, err := commandConfigPath(*configFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	_, hosts, err := commandHosts(path, *profile, *names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := export(os.Stdout, hosts, *prefix); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportTestConfig has a host on the defaults, one with every ssh setting and socket
+// forwards, and a disabled one
+const exportTestConfig = `defaults:
+  jump_host: bastion.example.com
+hosts:
+  - name: app
+    local_ip: 127.0.0.2
+    remote_host: app.internal
+    ports: [80, 443]
+  - name: db.local
+    local_ip: 127.0.0.3
+    hostnames: [db.local, database.local]
+    remote_host: postgres.internal
+    jump_port: 2222
+    key_path: ~/.ssh/work key
+    identity_agent: /tmp/agent.sock
+    ports:
+      - 5432
+      - port: 5432
+        listen_socket: /tmp/pg.sock
+  - name: docker
+    remote_socket: /var/run/docker.sock
+    local_socket: /tmp/docker.sock
+  - name: off
+    enabled: false
+    local_ip: 127.0.0.5
+    remote_host: off.internal
+    ports: [22]
+`
+
+func TestExportFormats(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{"config.yaml": exportTestConfig})
+	_, hosts, err := commandHosts(path, "", "")
+	if err != nil {
+		t.Fatalf("commandHosts() error = %v", err)
+	}
+
+	tests := []struct {
+		format string
+		prefix string
+		want   string
+	}{
+		{
+			format: "ssh-cmd",
+			want: `# app (` + path + `:4); /etc/hosts: 127.0.0.2 app.internal
+ssh -N -o ExitOnForwardFailure=yes -L 127.0.0.2:80:app.internal:80 -L 127.0.0.2:443:app.internal:443 bastion.example.com
+
+# db.local (` + path + `:8); /etc/hosts: 127.0.0.3 db.local database.local
+ssh -N -o ExitOnForwardFailure=yes -p 2222 -i ~/'.ssh/work key' -o IdentityAgent=/tmp/agent.sock -L 127.0.0.3:5432:postgres.internal:5432 -L /tmp/pg.sock:postgres.internal:5432 bastion.example.com
+
+# docker (` + path + `:19)
+ssh -N -o ExitOnForwardFailure=yes -L /tmp/docker.sock:/var/run/docker.sock bastion.example.com
+`,
+		},
+		{
+			format: "ssh-config",
+			want: `# app (` + path + `:4); /etc/hosts: 127.0.0.2 app.internal
+Host app
+  HostName bastion.example.com
+  LocalForward 127.0.0.2:80 app.internal:80
+  LocalForward 127.0.0.2:443 app.internal:443
+  ExitOnForwardFailure yes
+
+# db.local (` + path + `:8); /etc/hosts: 127.0.0.3 db.local database.local
+Host db.local
+  HostName bastion.example.com
+  Port 2222
+  IdentityFile "~/.ssh/work key"
+  IdentityAgent /tmp/agent.sock
+  LocalForward 127.0.0.3:5432 postgres.internal:5432
+  LocalForward /tmp/pg.sock postgres.internal:5432
+  ExitOnForwardFailure yes
+
+# docker (` + path + `:19)
+Host docker
+  HostName bastion.example.com
+  LocalForward /tmp/docker.sock /var/run/docker.sock
+  ExitOnForwardFailure yes
+`,
+		},
+		{
+			format: "env",
+			prefix: "PORTSMITH_",
+			want: `# app (` + path + `:4); /etc/hosts: 127.0.0.2 app.internal
+export PORTSMITH_APP_HOST=127.0.0.2 PORTSMITH_APP_PORT=80 PORTSMITH_APP_PORTS='80 443'
+# db.local (` + path + `:8); /etc/hosts: 127.0.0.3 db.local database.local
+export PORTSMITH_DB_LOCAL_HOST=127.0.0.3 PORTSMITH_DB_LOCAL_PORT=5432 PORTSMITH_DB_LOCAL_SOCKET=/tmp/pg.sock
+# docker (` + path + `:19)
+export PORTSMITH_DOCKER_SOCKET=/tmp/docker.sock
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := exportFormats[tt.format](&buf, hosts, tt.prefix); err != nil {
+				t.Fatalf("export error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandHosts(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{"config.yaml": exportTestConfig})
+
+	tests := []struct {
+		name    string
+		names   string
+		want    []string
+		wantErr string
+	}{
+		{"enabled hosts", "", []string{"app", "db.local", "docker"}, ""},
+		{"named hosts in order, even if disabled", "off, app", []string{"off", "app"}, ""},
+		{"unknown host", "app,nope", nil, `no host named "nope"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, hosts, err := commandHosts(path, "", tt.names)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("commandHosts() error = %v", err)
+			}
+			var got []string
+			for _, host := range hosts {
+				got = append(got, host.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hosts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Runtime toggles in the state file are respected
+	enabled := true
+	state := &State{Hosts: map[string]HostState{"off": {Enabled: &enabled}}}
+	if err := state.Save(StatePath(path)); err != nil {
+		t.Fatal(err)
+	}
+	_, hosts, err := commandHosts(path, "", "")
+	if err != nil {
+		t.Fatalf("commandHosts() error = %v", err)
+	}
+	if len(hosts) != 4 {
+		t.Errorf("got %d hosts, want the toggled host included", len(hosts))
+	}
+}
+
+func TestHostEnvName(t *testing.T) {
+	host := HostConfig{Name: "10.0.0.5", LocalIP: "127.0.0.2", Ports: []interface{}{80}}
+	env, err := hostEnv(host, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"_10_0_0_5_HOST=127.0.0.2", "_10_0_0_5_PORT=80"}; !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"":                    "''",
+		"127.0.0.2:80:db:80":  "127.0.0.2:80:db:80",
+		"~/.ssh/id_rsa":       "~/.ssh/id_rsa",
+		"~/My Keys/id":        "~/'My Keys/id'",
+		"it's":                `'it'\''s'`,
+		"[::1]:80":            "'[::1]:80'",
+		"$HOME":               "'$HOME'",
+		"IdentityAgent=/tmp/": "IdentityAgent=/tmp/",
+	}
+	for input, want := range tests {
+		if got := shellQuote(input); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// errFaultReset is returned by fault-injecting writers when a connection should be reset
+var errFaultReset = errors.New("connection reset by fault injection")
+
+// FaultConfig describes failures to inject into a host's connections for testing clients
+// against flaky links
+type FaultConfig struct {
+	Enabled           bool          `yaml:"enabled"`            // Inject faults from startup; can be toggled at runtime
+	Latency           time.Duration `yaml:"latency"`            // Delay added to every chunk forwarded in either direction
+	Jitter            time.Duration `yaml:"jitter"`             // Random extra delay of up to this much per chunk
+	ResetAfter        ByteSize      `yaml:"reset_after"`        // Reset connections once this many bytes have been forwarded
+	ResetProbability  *float64      `yaml:"reset_probability"`  // Chance a connection is reset at reset_after (default: 1)
+	RefuseProbability float64       `yaml:"refuse_probability"` // Chance a new connection is reset immediately
+	Blackhole         bool          `yaml:"blackhole"`          // Accept connections but never forward any data
+}
+
+// validate checks the fault settings for invalid values; name prefixes error messages
+func (f FaultConfig) validate(name string) error {
+	if f.Latency < 0 || f.Jitter < 0 {
+		return fmt.Errorf("invalid %s: latency and jitter must not be negative", name)
+	}
+	if f.ResetAfter < 0 {
+		return fmt.Errorf("invalid %s.reset_after: must not be negative", name)
+	}
+	if p := f.ResetProbability; p != nil && (*p < 0 || *p > 1) {
+		return fmt.Errorf("invalid %s.reset_probability: must be between 0 and 1", name)
+	}
+	if f.RefuseProbability < 0 || f.RefuseProbability > 1 {
+		return fmt.Errorf("invalid %s.refuse_probability: must be between 0 and 1", name)
+	}
+	return nil
+}
+
+// configured reports whether any fault is set, regardless of Enabled
+func (f FaultConfig) configured() bool {
+	return f.Latency > 0 || f.Jitter > 0 || f.ResetAfter > 0 || f.RefuseProbability > 0 || f.Blackhole
+}
+
+// delay returns the latency to add to one chunk, including random jitter
+func (f FaultConfig) delay() time.Duration {
+	delay := f.Latency
+	if f.Jitter > 0 {
+		delay += rand.N(f.Jitter)
+	}
+	return delay
+}
+
+// resetProbability returns the chance of a reset, defaulting to always when reset_after is set
+func (f FaultConfig) resetProbability() float64 {
+	if f.ResetProbability == nil {
+		return 1
+	}
+	return *f.ResetProbability
+}
+
+// faultState holds a host's current fault settings, which can be swapped at runtime
+type faultState struct {
+	config atomic.Pointer[FaultConfig]
+}
+
+// newFaultState creates the runtime fault state for a host
+func newFaultState(config FaultConfig) *faultState {
+	state := &faultState{}
+	state.config.Store(&config)
+	return state
+}
+
+// get returns the current fault settings
+func (s *faultState) get() FaultConfig {
+	return *s.config.Load()
+}
+
+// set replaces the fault settings; connections already open pick up latency and reset changes
+func (s *faultState) set(config FaultConfig) {
+	s.config.Store(&config)
+}
+
+// active returns the current settings and whether any fault should be injected
+func (s *faultState) active() (FaultConfig, bool) {
+	config := s.get()
+	return config, config.Enabled && config.configured()
+}
+
+// faultConn applies a host's faults to the two copy directions of one connection
+type faultConn struct {
+	state     *faultState
+	resetRoll float64 // Compared against reset_probability, fixed per connection
+	bytes     atomic.Int64
+}
+
+// newFaultConn starts tracking faults for a new connection
+func newFaultConn(state *faultState) *faultConn {
+	return &faultConn{state: state, resetRoll: rand.Float64()}
+}
+
+// refuse reports whether the connection should be refused outright, drawn independently
+// of whether it will be reset
+func (fc *faultConn) refuse() bool {
+	config, active := fc.state.active()
+	return active && config.RefuseProbability > 0 && rand.Float64() < config.RefuseProbability
+}
+
+// writer wraps w so writes are delayed and the connection is reset per the host's faults
+func (fc *faultConn) writer(w io.Writer) io.Writer {
+	return &faultWriter{w: w, conn: fc}
+}
+
+// faultWriter injects latency and resets into one direction of a connection
+type faultWriter struct {
+	w    io.Writer
+	conn *faultConn
+}
+
+func (fw *faultWriter) Write(p []byte) (int, error) {
+	config, active := fw.conn.state.active()
+	if !active {
+		return fw.w.Write(p)
+	}
+
+	time.Sleep(config.delay())
+
+	if config.ResetAfter > 0 && fw.conn.resetRoll < config.resetProbability() {
+		remaining := int64(config.ResetAfter) - fw.conn.bytes.Add(int64(len(p))) + int64(len(p))
+		if remaining <= 0 {
+			return 0, errFaultReset
+		}
+		if remaining < int64(len(p)) {
+			n, err := fw.w.Write(p[:remaining])
+			if err != nil {
+				return n, err
+			}
+			return n, errFaultReset
+		}
+	}
+
+	return fw.w.Write(p)
+}
+
+// resetConn closes conn with a TCP reset instead of an orderly shutdown where possible
+func resetConn(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
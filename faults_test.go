@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaultConfigValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		faults    FaultConfig
+		shouldErr bool
+	}{
+		{"empty", FaultConfig{}, false},
+		{"all set", FaultConfig{Enabled: true, Latency: time.Second, Jitter: time.Second, ResetAfter: 1024, ResetProbability: floatPtr(0.5), RefuseProbability: 0.1, Blackhole: true}, false},
+		{"negative latency", FaultConfig{Latency: -time.Second}, true},
+		{"negative reset_after", FaultConfig{ResetAfter: -1}, true},
+		{"reset probability over 1", FaultConfig{ResetProbability: floatPtr(1.5)}, true},
+		{"negative refuse probability", FaultConfig{RefuseProbability: -0.1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.faults.validate("faults")
+			if (err != nil) != tt.shouldErr {
+				t.Errorf("validate() error = %v, shouldErr %v", err, tt.shouldErr)
+			}
+		})
+	}
+}
+
+func TestFaultWriterReset(t *testing.T) {
+	state := newFaultState(FaultConfig{Enabled: true, ResetAfter: 10})
+	conn := newFaultConn(state)
+
+	// Both directions count towards reset_after
+	var up, down bytes.Buffer
+	if _, err := conn.writer(&up).Write([]byte("123456")); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	n, err := conn.writer(&down).Write([]byte("abcdef"))
+	if !errors.Is(err, errFaultReset) {
+		t.Fatalf("Write() error = %v, want errFaultReset", err)
+	}
+	if n != 4 || down.String() != "abcd" {
+		t.Errorf("Write() = %d (%q), want the 4 bytes before reset_after", n, down.String())
+	}
+	if _, err := conn.writer(&up).Write([]byte("x")); !errors.Is(err, errFaultReset) {
+		t.Errorf("Write() after reset error = %v, want errFaultReset", err)
+	}
+
+	// Disabling faults at runtime lets the connection continue
+	state.set(FaultConfig{ResetAfter: 10})
+	if _, err := conn.writer(&up).Write([]byte("x")); err != nil {
+		t.Errorf("Write() with faults disabled unexpected error: %v", err)
+	}
+}
+
+func TestFaultWriterResetProbability(t *testing.T) {
+	state := newFaultState(FaultConfig{Enabled: true, ResetAfter: 1, ResetProbability: floatPtr(0.5)})
+
+	conn := newFaultConn(state)
+	conn.resetRoll = 0.9
+	if _, err := conn.writer(&bytes.Buffer{}).Write([]byte("data")); err != nil {
+		t.Errorf("Write() for a connection that rolled above reset_probability error = %v", err)
+	}
+
+	conn = newFaultConn(state)
+	conn.resetRoll = 0.1
+	if _, err := conn.writer(&bytes.Buffer{}).Write([]byte("data")); !errors.Is(err, errFaultReset) {
+		t.Errorf("Write() for a connection that rolled below reset_probability error = %v, want errFaultReset", err)
+	}
+
+	// An explicit 0 never resets, unlike leaving reset_probability unset
+	state.set(FaultConfig{Enabled: true, ResetAfter: 1, ResetProbability: floatPtr(0)})
+	conn = newFaultConn(state)
+	conn.resetRoll = 0
+	if _, err := conn.writer(&bytes.Buffer{}).Write([]byte("data")); err != nil {
+		t.Errorf("Write() with reset_probability 0 error = %v", err)
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestFaultConnRefuseAndResetIndependent(t *testing.T) {
+	state := newFaultState(FaultConfig{Enabled: true, RefuseProbability: 0.5, ResetAfter: 1, ResetProbability: floatPtr(0.5)})
+
+	reset := 0
+	for i := 0; i < 1000; i++ {
+		conn := newFaultConn(state)
+		if conn.refuse() {
+			continue
+		}
+		if _, err := conn.writer(&bytes.Buffer{}).Write([]byte("data")); errors.Is(err, errFaultReset) {
+			reset++
+		}
+	}
+	if reset == 0 {
+		t.Error("no connection that survived refuse_probability was reset, want the two drawn independently")
+	}
+}
+
+func TestFaultWriterLatency(t *testing.T) {
+	conn := newFaultConn(newFaultState(FaultConfig{Enabled: true, Latency: 30 * time.Millisecond}))
+
+	start := time.Now()
+	if _, err := conn.writer(&bytes.Buffer{}).Write([]byte("data")); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Write() took %v, want at least the configured latency", elapsed)
+	}
+}
+
+func TestFaultConnRefuse(t *testing.T) {
+	state := newFaultState(FaultConfig{RefuseProbability: 1})
+	if newFaultConn(state).refuse() {
+		t.Error("refuse() should not refuse while faults are disabled")
+	}
+
+	state.set(FaultConfig{Enabled: true, RefuseProbability: 1})
+	if !newFaultConn(state).refuse() {
+		t.Error("refuse() should refuse with refuse_probability 1")
+	}
+}
+
+func TestDynamicForwarderFaultToggles(t *testing.T) {
+	df := &DynamicForwarder{
+		faults: map[string]*faultState{
+			"db":  newFaultState(FaultConfig{Latency: time.Second}),
+			"api": newFaultState(FaultConfig{}),
+		},
+	}
+
+	df.SetFaultsEnabled(true)
+	faults := df.Faults()
+	if !faults["db"].Enabled {
+		t.Error("SetFaultsEnabled(true) should enable hosts with faults configured")
+	}
+	if faults["api"].Enabled {
+		t.Error("SetFaultsEnabled(true) should leave hosts without faults alone")
+	}
+
+	if err := df.SetHostFaults("api", FaultConfig{Enabled: true, Blackhole: true}); err != nil {
+		t.Fatalf("SetHostFaults() unexpected error: %v", err)
+	}
+	if _, active := df.faults["api"].active(); !active {
+		t.Error("SetHostFaults() should take effect immediately")
+	}
+
+	if err := df.SetHostFaults("cache", FaultConfig{}); err == nil {
+		t.Error("SetHostFaults() should fail for an unknown host")
+	}
+	if err := df.SetHostFaults("db", FaultConfig{RefuseProbability: 2}); err == nil {
+		t.Error("SetHostFaults() should reject invalid settings")
+	}
+}
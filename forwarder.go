@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,47 +29,123 @@ type StatusUpdate struct {
 
 // DynamicForwarder orchestrates the dynamic port forwarding
 type DynamicForwarder struct {
-	configPath   string
-	configs      []HostConfig
-	netSetup     *NetworkSetup
-	sshPool      *SSHClientPool
-	cleanup      []func() error
-	running      bool
-	statusChan   chan StatusUpdate
-	errorCount   int
-	errorMu      sync.Mutex
-	lastErrors   []string
-	maxErrors    int
-}
-
-// NewDynamicForwarder creates a new dynamic forwarder
-func NewDynamicForwarder(configPath string, configs []HostConfig, helperPath string) (*DynamicForwarder, error) {
+	configPath string
+	configs    []HostConfig
+	netSetup   *NetworkSetup
+	sshPool    *SSHClientPool
+	stats      *Stats
+	accessLog  *AccessLog
+	connIDs    atomic.Uint64
+
+	jumpHostLimits map[string]ConnectionLimits
+	jumpLimiters   map[string]*connLimiter
+	limitersMu     sync.Mutex
+	bandwidthLimit BandwidthLimit
+	globalUp       *tokenBucket // Shared by every connection of the current run
+	globalDown     *tokenBucket
+
+	faults   map[string]*faultState // Keyed by host name
+	faultsMu sync.Mutex
+
+	// Hosts forwarded in the current run, keyed by host name. configs, state and runs are
+	// only changed with lifecycleMu held; hostsMu lets readers see them while Start is busy.
+	runs      map[string]*hostRun
+	state     *State
+	statePath string
+	profile   string                    // Profile requested on the command line or selected at runtime
+	profiles  []string                  // Profiles defined in the config
+	active    string                    // Profile in use, which may be the config's default
+	aliases   map[string]*loopbackAlias // Keyed by IP, shared by hosts using the same local IP
+	hostsMu   sync.Mutex
+
+	drainTimeout time.Duration
+
+	lifecycleMu sync.Mutex // Serializes Start, Stop, Close and host toggles
+	running     bool
+	runningMu   sync.Mutex
+
+	events EventBus
+	hooks  *hookRunner
+
+	health     HealthStatus
+	healthMu   sync.Mutex
+	errorCount int
+	errorMu    sync.Mutex
+	lastErrors []string
+	maxErrors  int
+}
+
+// NewDynamicForwarder creates a new dynamic forwarder. profile selects the config profile
+// to forward; when empty, the profile last selected at runtime or the config's default is used.
+func NewDynamicForwarder(configPath, profile string, configs []HostConfig, helperPath string) (*DynamicForwarder, error) {
 	netSetup, err := NewNetworkSetup(helperPath)
 	if err != nil {
 		return nil, err
 	}
 
+	stats := NewStats()
 	sshPool := NewSSHClientPool()
 
-	return &DynamicForwarder{
-		configPath: configPath,
-		configs:    configs,
-		netSetup:   netSetup,
-		sshPool:    sshPool,
-		cleanup:    make([]func() error, 0),
-		statusChan: make(chan StatusUpdate, 10),
-		lastErrors: make([]string, 0),
-		maxErrors:  5,
-	}, nil
+	df := &DynamicForwarder{
+		configPath:   configPath,
+		configs:      configs,
+		statePath:    StatePath(configPath),
+		profile:      profile,
+		netSetup:     netSetup,
+		sshPool:      sshPool,
+		stats:        stats,
+		lastErrors:   make([]string, 0),
+		maxErrors:    5,
+		drainTimeout: DefaultDrainTimeout,
+		hooks:        newHookRunner(),
+	}
+	go df.hooks.run(df.events.Subscribe(hookEventTypes...))
+
+	sshPool.onHandshake = func(jumpAddr string) {
+		stats.recordHandshake(jumpAddr)
+		df.events.Publish(Event{Type: EventSSHConnected, JumpHost: jumpAddr})
+	}
+	sshPool.onDisconnect = func(jumpAddr string, err error) {
+		df.events.Publish(Event{Type: EventSSHDisconnected, JumpHost: jumpAddr, Err: err})
+	}
+	sshPool.onAuthNeeded = func(keyPath string, err error) {
+		df.events.Publish(Event{Type: EventAuthNeeded, Message: keyPath, Err: err})
+	}
+
+	return df, nil
+}
+
+// Subscribe returns a subscription to forwarder events of the given types, or all events
+// if none are given. Subscriptions stay open across Start/Stop cycles until closed.
+func (df *DynamicForwarder) Subscribe(types ...EventType) *Subscription {
+	return df.events.Subscribe(types...)
+}
+
+// SetAccessLog sets where per-connection records are written for hosts with access_log enabled
+func (df *DynamicForwarder) SetAccessLog(accessLog *AccessLog) {
+	df.accessLog = accessLog
 }
 
-// GetStatusChan returns the status update channel
-func (df *DynamicForwarder) GetStatusChan() <-chan StatusUpdate {
-	return df.statusChan
+// Stats returns a snapshot of per-forward and per-jump-host traffic counters
+func (df *DynamicForwarder) Stats() StatsSnapshot {
+	return df.stats.Snapshot()
 }
 
 // recordError tracks connection errors and updates health status
 func (df *DynamicForwarder) recordError(err error) {
+	df.trackError(Event{Type: EventError, Message: err.Error(), Err: err})
+}
+
+// recordForwardError is recordError for errors on a specific forward, so the error
+// event (and any on_error hooks) can tell which host it belongs to
+func (df *DynamicForwarder) recordForwardError(cfg ForwardConfig, err error) {
+	df.trackError(forwardEvent(EventError, cfg, func(e *Event) { e.Message, e.Err = err.Error(), err }))
+}
+
+// trackError adds an error event's error to the recent errors, publishes the event and
+// reports degraded health
+func (df *DynamicForwarder) trackError(event Event) {
+	err := event.Err
 	df.errorMu.Lock()
 	defer df.errorMu.Unlock()
 
@@ -78,13 +156,28 @@ func (df *DynamicForwarder) recordError(err error) {
 	}
 	df.errorCount++
 
-	select {
-	case df.statusChan <- StatusUpdate{
+	df.events.Publish(event)
+	df.sendStatus(StatusUpdate{
 		Health:  StatusDegraded,
 		Message: fmt.Sprintf("%d connection errors - %v", df.errorCount, err),
-	}:
-	default:
-	}
+	})
+}
+
+// sendStatus records the current health and publishes it as a status event
+func (df *DynamicForwarder) sendStatus(update StatusUpdate) {
+	df.healthMu.Lock()
+	df.health = update.Health
+	df.healthMu.Unlock()
+
+	df.events.Publish(Event{Type: EventStatus, Health: update.Health, Message: update.Message})
+}
+
+// Health returns the most recently reported health status
+func (df *DynamicForwarder) Health() HealthStatus {
+	df.healthMu.Lock()
+	defer df.healthMu.Unlock()
+
+	return df.health
 }
 
 // clearErrors resets error tracking
@@ -108,13 +201,32 @@ func (df *DynamicForwarder) GetLastErrors() []string {
 
 // reloadConfig re-reads the configuration file and updates internal state
 func (df *DynamicForwarder) reloadConfig() error {
-	log.Printf("Reloading configuration from: %s", df.configPath)
-	config, err := LoadConfig(df.configPath)
+	slog.Info("Reloading configuration", "path", df.configPath)
+	state, err := LoadState(df.statePath)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadProfileConfig(df.configPath, df.profile, state)
 	if err != nil {
 		return fmt.Errorf("failed to reload config: %w", err)
 	}
+	if err := configureLogging(config); err != nil {
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+	if df.accessLog != nil {
+		df.accessLog.SetRotation(config.LogRotation)
+	}
+
+	df.hostsMu.Lock()
+	df.state = state
+	df.hostsMu.Unlock()
+	df.applyHosts(config)
 
-	df.configs = config.Hosts
+	df.jumpHostLimits = config.JumpHostLimits
+	df.bandwidthLimit = config.BandwidthLimit
+	df.drainTimeout = config.DrainTimeout
+	df.events.Publish(Event{Type: EventConfigReloaded, Message: df.configPath})
 
 	// Note: We don't load SSH auth methods here (lazy loading).
 	// Auth methods will be loaded on-demand when connections are made.
@@ -122,189 +234,534 @@ func (df *DynamicForwarder) reloadConfig() error {
 	return nil
 }
 
-// setupNetwork configures all network settings
-func (df *DynamicForwarder) setupNetwork() error {
-	cleanup, err := df.netSetup.SetupNetwork(df.configs)
-	if err != nil {
-		return err
-	}
-	df.cleanup = append(df.cleanup, cleanup...)
-	return nil
-}
-
-// Start begins the port forwarding
+// Start begins the port forwarding. It can be called again after Stop.
 func (df *DynamicForwarder) Start() error {
-	if df.running {
+	df.lifecycleMu.Lock()
+	defer df.lifecycleMu.Unlock()
+
+	if df.IsRunning() {
 		return fmt.Errorf("forwarder is already running")
 	}
 
-	if err := df.reloadConfig(); err != nil {
+	if err := df.start(); err != nil {
+		df.teardown()
 		return err
 	}
 
-	log.Printf("Cleaning up stale resources from previous runs...")
-	if err := df.netSetup.Cleanup(); err != nil {
-		log.Printf("Initial cleanup failed: %v", err)
-	}
-	log.Printf("Stale resource cleanup complete")
+	df.setRunning(true)
+	df.clearErrors()
+
+	df.sendStatus(StatusUpdate{
+		Health:  StatusHealthy,
+		Message: "Port forwarding started",
+	})
 
-	if err := df.setupNetwork(); err != nil {
+	slog.Info("Port forwarding started")
+	return nil
+}
+
+// start sets up network state and listeners for every configured host
+func (df *DynamicForwarder) start() error {
+	if err := df.reloadConfig(); err != nil {
 		return err
 	}
 
-	for _, cfg := range df.configs {
-		displayName := cfg.RemoteHost
-		if len(cfg.Hostnames) > 0 {
-			displayName = fmt.Sprintf("%s (%s)", strings.Join(cfg.Hostnames, ", "), cfg.RemoteHost)
-		}
+	df.resetRun()
 
-		ports, err := ExpandPorts(cfg)
-		if err != nil {
-			return fmt.Errorf("failed to expand ports for %s: %w", displayName, err)
-		}
+	slog.Info("Cleaning up stale resources from previous runs")
+	if err := df.netSetup.Cleanup(); err != nil {
+		slog.Warn("Initial cleanup failed", "error", err)
+	}
+	slog.Info("Stale resource cleanup complete")
 
-		if len(ports) == 0 {
-			log.Printf("%s has no ports configured - skipping", displayName)
+	for _, cfg := range df.configs {
+		if !df.state.hostEnabled(cfg) {
+			slog.Info("Host is disabled - skipping", "host", cfg.Name)
 			continue
 		}
+		if err := df.startHost(cfg, false); err != nil {
+			return err
+		}
+	}
 
-		log.Printf("Setting up %s -> %s (%d ports)",
-			cfg.LocalIP, displayName, len(ports))
+	return nil
+}
 
-		for _, port := range ports {
-			fwdCfg := NewForwardConfig(cfg, port)
+// resetRun gives a new run fresh jump host limiters, global bandwidth buckets and fault state
+func (df *DynamicForwarder) resetRun() {
+	df.limitersMu.Lock()
+	df.jumpLimiters = make(map[string]*connLimiter)
+	df.limitersMu.Unlock()
 
-			if fwdCfg.NeedsPFRedirect() {
-				cleanup, err := df.netSetup.SetupPFRedirect(fwdCfg.LocalIP, fwdCfg.Port, fwdCfg.ListenPort)
-				if err != nil {
-					return fmt.Errorf("failed to setup pf redirect for %s:%d: %w", fwdCfg.LocalIP, fwdCfg.Port, err)
-				}
-				df.cleanup = append(df.cleanup, cleanup)
-			}
+	df.globalUp = newTokenBucket(df.bandwidthLimit.Up)
+	df.globalDown = newTokenBucket(df.bandwidthLimit.Down)
 
-			go df.listenAndForward(fwdCfg)
-		}
-	}
+	df.faultsMu.Lock()
+	df.faults = make(map[string]*faultState)
+	df.faultsMu.Unlock()
+}
 
-	df.running = true
-	df.clearErrors()
+// Stop stops accepting connections, waits up to the drain timeout for open connections
+// to finish, then tears down SSH clients and network state. The forwarder can be
+// started again afterwards.
+func (df *DynamicForwarder) Stop() error {
+	df.lifecycleMu.Lock()
+	defer df.lifecycleMu.Unlock()
 
-	select {
-	case df.statusChan <- StatusUpdate{
-		Health:  StatusHealthy,
-		Message: "Port forwarding started",
-	}:
-	default:
+	if !df.IsRunning() {
+		return nil
 	}
 
-	log.Printf("Port forwarding started")
+	slog.Info("Stopping port forwarding")
+	df.setRunning(false)
+	df.drain(df.hostRuns())
+	df.teardown()
 	return nil
 }
 
-// Stop stops the port forwarding and cleans up
-func (df *DynamicForwarder) Stop() error {
-	if !df.running {
-		return nil
+// DrainTimeout returns how long Stop waits for open connections to finish
+func (df *DynamicForwarder) DrainTimeout() time.Duration {
+	return df.drainTimeout
+}
+
+// drain closes the listeners of the given hosts and waits for their open connections,
+// closing any that are still running when the drain timeout expires
+func (df *DynamicForwarder) drain(runs []*hostRun) {
+	for _, run := range runs {
+		run.stopListening()
+	}
+	for _, run := range runs {
+		run.listeners.Wait()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, run := range runs {
+			run.connections.Wait()
+		}
+		close(done)
+	}()
+
+	if active := df.stats.Snapshot().ActiveConnections(); active > 0 {
+		slog.Info("Waiting for connections to finish", "active", active, "timeout", df.drainTimeout)
 	}
 
-	log.Printf("Stopping port forwarding...")
-	df.running = false
-	return df.Close()
+	timer := time.NewTimer(df.drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		slog.Warn("Drain timeout reached, closing remaining connections",
+			"active", df.stats.Snapshot().ActiveConnections())
+		for _, run := range runs {
+			run.closeConns()
+		}
+		waitClosed(runs, done)
+	}
 }
 
 // IsRunning returns whether the forwarder is currently running
 func (df *DynamicForwarder) IsRunning() bool {
+	df.runningMu.Lock()
+	defer df.runningMu.Unlock()
+
 	return df.running
 }
 
-// Close shuts down the forwarder and cleans up resources
+// setRunning updates the running flag
+func (df *DynamicForwarder) setRunning(running bool) {
+	df.runningMu.Lock()
+	defer df.runningMu.Unlock()
+
+	df.running = running
+}
+
+// Close immediately closes all connections and cleans up resources without draining.
+// Status subscriptions stay open.
 func (df *DynamicForwarder) Close() error {
-	close(df.statusChan)
+	df.lifecycleMu.Lock()
+	defer df.lifecycleMu.Unlock()
+
+	df.setRunning(false)
+	df.teardown()
+	return nil
+}
+
+// teardown stops every host, undoing its network state, then closes the SSH clients,
+// leaving the forwarder ready to start again
+func (df *DynamicForwarder) teardown() {
+	for _, run := range df.hostRuns() {
+		df.stopHost(run)
+	}
+
 	df.sshPool.Close()
+}
 
-	for i := len(df.cleanup) - 1; i >= 0; i-- {
-		if err := df.cleanup[i](); err != nil {
-			log.Printf("Cleanup error: %v", err)
-		}
+// forwardRuntime holds the limiters and fault state shared by all connections of a single forward
+type forwardRuntime struct {
+	conns  *connLimiter
+	up     []*tokenBucket // Host and global upload buckets (nil entries are unlimited)
+	down   []*tokenBucket
+	faults *faultState // Shared by all forwards of the host
+	run    *hostRun    // Lifecycle of the host the forward belongs to
+}
+
+// Faults returns the current fault injection settings for each host, keyed by host name
+func (df *DynamicForwarder) Faults() map[string]FaultConfig {
+	df.faultsMu.Lock()
+	defer df.faultsMu.Unlock()
+
+	faults := make(map[string]FaultConfig, len(df.faults))
+	for host, state := range df.faults {
+		faults[host] = state.get()
+	}
+	return faults
+}
+
+// SetHostFaults replaces a running host's fault injection settings without restarting.
+// New connections use them immediately; open connections pick up latency and reset changes.
+func (df *DynamicForwarder) SetHostFaults(host string, faults FaultConfig) error {
+	if err := faults.validate("faults"); err != nil {
+		return err
 	}
 
+	df.faultsMu.Lock()
+	defer df.faultsMu.Unlock()
+
+	state, exists := df.faults[host]
+	if !exists {
+		return fmt.Errorf("unknown host %q", host)
+	}
+	state.set(faults)
+	slog.Info("Fault injection updated", "host", host, "enabled", faults.Enabled)
 	return nil
 }
 
-// listenAndForward listens on a port and forwards connections
-func (df *DynamicForwarder) listenAndForward(cfg ForwardConfig) {
-	listenAddr := fmt.Sprintf("%s:%d", cfg.LocalIP, cfg.ListenPort)
-	listener, err := net.Listen("tcp", listenAddr)
+// SetFaultsEnabled switches fault injection on or off for every host with faults configured
+func (df *DynamicForwarder) SetFaultsEnabled(enabled bool) {
+	df.faultsMu.Lock()
+	defer df.faultsMu.Unlock()
+
+	for host, state := range df.faults {
+		faults := state.get()
+		if !faults.configured() || faults.Enabled == enabled {
+			continue
+		}
+		faults.Enabled = enabled
+		state.set(faults)
+		slog.Info("Fault injection updated", "host", host, "enabled", enabled)
+	}
+}
+
+// listenAndForward listens on a port and forwards connections until the host stops
+// listening. Connections are force-closed when the host closes its connections.
+func (df *DynamicForwarder) listenAndForward(cfg ForwardConfig, rt *forwardRuntime) {
+	defer rt.run.listeners.Done()
+	listenCtx := rt.run.listenCtx
+
+	network, listenAddr := cfg.ListenAddr()
+	logger := forwardLogger(cfg).With("listen", listenAddr)
+
+	var listener net.Listener
+	var err error
+	if network == "unix" {
+		listener, err = listenUnix(listenAddr, cfg.SocketMode)
+	} else {
+		listener, err = net.Listen(network, listenAddr)
+	}
 	if err != nil {
-		log.Printf("Failed to listen on %s: %v", listenAddr, err)
+		logger.Error("Failed to listen", "error", err)
+		df.events.Publish(forwardEvent(EventError, cfg, func(e *Event) { e.Message, e.Err = "failed to listen", err }))
 		return
 	}
 	defer listener.Close()
+	stop := context.AfterFunc(listenCtx, func() { listener.Close() })
+	defer stop()
+
+	df.events.Publish(forwardEvent(EventForwardStarted, cfg, nil))
+	defer func() {
+		df.events.Publish(forwardEvent(EventForwardStopped, cfg, nil))
+	}()
 
 	if cfg.NeedsPFRedirect() {
-		log.Printf("Listening on %s (redirected from %s:%d)", listenAddr, cfg.LocalIP, cfg.Port)
+		logger.Info("Listening", "redirected_from", fmt.Sprintf("%s:%d", cfg.LocalIP, cfg.Port))
 	} else {
-		log.Printf("Listening on %s", listenAddr)
+		logger.Info("Listening")
 	}
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("Accept error on %s: %v", listenAddr, err)
+			if listenCtx.Err() != nil {
+				logger.Info("Stopped listening")
+			} else {
+				logger.Error("Accept error", "error", err)
+			}
 			return
 		}
 
-		go df.forwardConnection(conn, cfg)
+		connID := df.connIDs.Add(1)
+		logger.Debug("Accepted connection", "conn_id", connID, "client", conn.RemoteAddr().String())
+		rt.run.connections.Add(1)
+		go df.forwardConnection(rt.run.connCtx, conn, cfg, connID, rt)
+	}
+}
+
+// forwardEvent creates an event describing a forward, letting set fill in event-specific fields
+func forwardEvent(eventType EventType, cfg ForwardConfig, set func(*Event)) Event {
+	_, listen := cfg.ListenAddr()
+	_, remote := cfg.RemoteAddr()
+	event := Event{
+		Type:     eventType,
+		Name:     cfg.Name,
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Listen:   listen,
+		Remote:   remote,
+		JumpHost: fmt.Sprintf("%s:%d", cfg.JumpHost, cfg.JumpPort),
+	}
+	if set != nil {
+		set(&event)
+	}
+	return event
+}
+
+// jumpLimiter returns the shared limiter for a jump host, or nil if it has no limits.
+// Limits keyed by "host:port" take precedence over those keyed by host name alone.
+func (df *DynamicForwarder) jumpLimiter(jumpHost string, jumpPort int) *connLimiter {
+	jumpAddr := fmt.Sprintf("%s:%d", jumpHost, jumpPort)
+
+	df.limitersMu.Lock()
+	defer df.limitersMu.Unlock()
+
+	if limiter, exists := df.jumpLimiters[jumpAddr]; exists {
+		return limiter
 	}
+
+	limits, exists := df.jumpHostLimits[jumpAddr]
+	if !exists {
+		limits = df.jumpHostLimits[jumpHost]
+	}
+	limiter := newConnLimiter(limits)
+	if df.jumpLimiters == nil {
+		df.jumpLimiters = make(map[string]*connLimiter)
+	}
+	df.jumpLimiters[jumpAddr] = limiter
+	return limiter
+}
+
+// admitConnection applies the forward's limits and then its jump host's limits,
+// returning a function that frees both slots when the connection closes
+func (df *DynamicForwarder) admitConnection(ctx context.Context, cfg ForwardConfig, limiter *connLimiter) (func(), error) {
+	releaseForward, err := limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseJump, err := df.jumpLimiter(cfg.JumpHost, cfg.JumpPort).acquire(ctx)
+	if err != nil {
+		releaseForward()
+		df.stats.recordJumpHostRejected(fmt.Sprintf("%s:%d", cfg.JumpHost, cfg.JumpPort))
+		return nil, fmt.Errorf("jump host %s: %w", cfg.JumpHost, err)
+	}
+
+	return func() {
+		releaseJump()
+		releaseForward()
+	}, nil
 }
 
-// forwardConnection forwards a single connection through SSH
-func (df *DynamicForwarder) forwardConnection(localConn net.Conn, cfg ForwardConfig) {
+// forwardConnection forwards a single connection through SSH until either side closes
+// or ctx is cancelled
+func (df *DynamicForwarder) forwardConnection(ctx context.Context, localConn net.Conn, cfg ForwardConfig, connID uint64, rt *forwardRuntime) {
+	defer rt.run.connections.Done()
 	defer localConn.Close()
+	stop := context.AfterFunc(ctx, func() { localConn.Close() })
+	defer stop()
+
+	logger := forwardLogger(cfg).With("conn_id", connID)
+
+	counters := df.stats.forward(cfg)
+
+	network, remoteAddr := cfg.RemoteAddr()
+	connStart := time.Now()
+	var bytesIn, bytesOut atomic.Int64
+
+	record := AccessRecord{
+		Time:     connStart,
+		ConnID:   connID,
+		Client:   localConn.RemoteAddr().String(),
+		Local:    cfg.LocalAddr(),
+		Remote:   remoteAddr,
+		JumpHost: fmt.Sprintf("%s:%d", cfg.JumpHost, cfg.JumpPort),
+	}
+	if cfg.AccessLog && df.accessLog != nil {
+		defer func() {
+			record.DurationMS = time.Since(connStart).Milliseconds()
+			record.BytesIn = bytesIn.Load()
+			record.BytesOut = bytesOut.Load()
+			df.accessLog.Log(record)
+		}()
+	}
+
+	df.events.Publish(forwardEvent(EventConnectionOpened, cfg, func(e *Event) {
+		e.ConnID, e.Client = connID, record.Client
+	}))
+	defer func() {
+		df.events.Publish(forwardEvent(EventConnectionClosed, cfg, func(e *Event) {
+			e.ConnID, e.Client = connID, record.Client
+			e.Duration = time.Since(connStart)
+			e.BytesIn, e.BytesOut = bytesIn.Load(), bytesOut.Load()
+			e.Reason, e.Message = record.CloseReason, record.Error
+		}))
+	}()
+
+	if cfg.IdentifyClients {
+		peer, err := lookupPeerProcess(localConn)
+		if err != nil {
+			logger.Debug("Could not identify client process", "error", err)
+		} else {
+			logger = logger.With("client_pid", peer.PID, "client_process", peer.Name)
+			record.ClientPID, record.ClientProcess = peer.PID, peer.Name
+			counters.clientIdentified(peer.Name)
+		}
 
-	sshClient, err := df.sshPool.GetClient(cfg.JumpHost, cfg.JumpPort, cfg.KeyPath, cfg.IdentityAgent)
+		if len(cfg.AllowedProcesses) > 0 && (err != nil || !processAllowed(peer, cfg.AllowedProcesses)) {
+			logger.Warn("Rejected connection from process not in allowed_processes", "client", record.Client)
+			counters.rejectedConn()
+			record.CloseReason = CloseDenied
+			return
+		}
+	}
+
+	release, err := df.admitConnection(ctx, cfg, rt.conns)
+	if errors.Is(err, context.Canceled) {
+		record.CloseReason = CloseShutdown
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to get SSH client: %v", err)
-		df.recordError(fmt.Errorf("SSH client error for %s: %w", cfg.JumpHost, err))
+		// Not an error: a runaway client would otherwise flood the tray with them
+		logger.Warn("Rejected connection", "client", record.Client, "error", err)
+		counters.rejectedConn()
+		record.CloseReason, record.Error = CloseLimited, err.Error()
+		return
+	}
+
+	// Only admitted connections count as opened, and they stop counting once their slot is free
+	counters.connOpened()
+	defer counters.connClosed()
+	defer release()
+
+	faults := newFaultConn(rt.faults)
+	if faults.refuse() {
+		logger.Info("Refusing connection (fault injection)")
+		resetConn(localConn)
+		record.CloseReason = CloseFaultInjected
+		return
+	}
+	if config, active := rt.faults.active(); active && config.Blackhole {
+		logger.Info("Blackholing connection (fault injection)")
+		io.Copy(io.Discard, localConn)
+		record.CloseReason = CloseFaultInjected
 		return
 	}
 
-	remoteAddr := fmt.Sprintf("%s:%d", cfg.RemoteHost, cfg.Port)
-	remoteConn, err := sshClient.Dial("tcp", remoteAddr)
+	dialStart := time.Now()
+	sshClient, err := df.sshPool.GetClient(ctx, cfg.JumpHost, cfg.JumpPort, cfg.sshAuth())
+	if ctx.Err() != nil {
+		record.CloseReason = CloseShutdown
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get SSH client", "error", err)
+		counters.failed()
+		record.CloseReason, record.Error = CloseSSHError, err.Error()
+		df.recordForwardError(cfg, fmt.Errorf("SSH client error for %s: %w", cfg.JumpHost, err))
+		return
+	}
+
+	remoteConn, err := sshClient.Dial(network, remoteAddr)
 	if err != nil {
-		log.Printf("Connection failed, attempting reconnect: %v", err)
+		logger.Warn("Connection failed, attempting reconnect", "error", err)
 		df.sshPool.RemoveClient(cfg.JumpHost, cfg.JumpPort)
+		df.stats.recordReconnect(fmt.Sprintf("%s:%d", cfg.JumpHost, cfg.JumpPort))
 
-		sshClient, err = df.sshPool.GetClient(cfg.JumpHost, cfg.JumpPort, cfg.KeyPath, cfg.IdentityAgent)
+		sshClient, err = df.sshPool.GetClient(ctx, cfg.JumpHost, cfg.JumpPort, cfg.sshAuth())
+		if ctx.Err() != nil {
+			record.CloseReason = CloseShutdown
+			return
+		}
 		if err != nil {
-			log.Printf("Failed to reconnect: %v", err)
-			df.recordError(fmt.Errorf("reconnect failed for %s: %w", cfg.JumpHost, err))
+			logger.Error("Failed to reconnect", "error", err)
+			counters.failed()
+			record.CloseReason, record.Error = CloseSSHError, err.Error()
+			df.recordForwardError(cfg, fmt.Errorf("reconnect failed for %s: %w", cfg.JumpHost, err))
 			return
 		}
 
-		remoteConn, err = sshClient.Dial("tcp", remoteAddr)
+		remoteConn, err = sshClient.Dial(network, remoteAddr)
 		if err != nil {
-			log.Printf("Failed to dial %s after reconnect: %v", remoteAddr, err)
-			df.recordError(fmt.Errorf("dial failed for %s: %w", remoteAddr, err))
+			logger.Error("Failed to dial after reconnect", "remote", remoteAddr, "error", err)
+			counters.failed()
+			record.CloseReason, record.Error = CloseDialFailed, err.Error()
+			df.recordForwardError(cfg, fmt.Errorf("dial failed for %s: %w", remoteAddr, err))
 			return
 		}
 	}
 	defer remoteConn.Close()
+	dialLatency := time.Since(dialStart)
+	counters.dialed(dialLatency)
 
-	log.Printf("Forwarding: :%d -> %s", cfg.Port, remoteAddr)
+	logger.Info("Forwarding", "remote", remoteAddr, "dial_latency", dialLatency)
 
-	done := make(chan struct{}, 2)
+	type copyResult struct {
+		reason string
+		err    error
+	}
+	done := make(chan copyResult, 2)
 
 	go func() {
-		io.Copy(remoteConn, localConn)
-		done <- struct{}{}
+		_, err := io.Copy(faults.writer(newThrottledWriter(newCountingWriter(remoteConn, &counters.bytesIn, &bytesIn), rt.up...)), localConn)
+		if errors.Is(err, errFaultReset) {
+			done <- copyResult{CloseFaultInjected, err}
+			return
+		}
+		if err != nil {
+			done <- copyResult{CloseClientError, err}
+			return
+		}
+		done <- copyResult{CloseClientClosed, nil}
 	}()
 
 	go func() {
-		io.Copy(localConn, remoteConn)
-		done <- struct{}{}
+		_, err := io.Copy(faults.writer(newThrottledWriter(newCountingWriter(localConn, &counters.bytesOut, &bytesOut), rt.down...)), remoteConn)
+		if errors.Is(err, errFaultReset) {
+			done <- copyResult{CloseFaultInjected, err}
+			return
+		}
+		if err != nil {
+			done <- copyResult{CloseRemoteError, err}
+			return
+		}
+		done <- copyResult{CloseRemoteClosed, nil}
 	}()
 
-	<-done
-	log.Printf("Connection closed: :%d", cfg.Port)
+	result := <-done
+	if result.reason == CloseFaultInjected {
+		resetConn(localConn)
+	}
+	if ctx.Err() != nil {
+		result = copyResult{CloseShutdown, nil}
+	}
+	record.CloseReason = result.reason
+	if result.err != nil {
+		record.Error = result.err.Error()
+	}
+
+	logger.Info("Connection closed",
+		"reason", result.reason,
+		"duration", time.Since(connStart),
+		"bytes_in", bytesIn.Load(),
+		"bytes_out", bytesOut.Load())
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startBlackholeForward starts a single forward on a free loopback port whose connections
+// are held open by fault injection, so they stay active without an SSH server
+func startBlackholeForward(t *testing.T, df *DynamicForwarder) string {
+	t.Helper()
+	return startLimitedBlackholeForward(t, df, ConnectionLimits{})
+}
+
+// startLimitedBlackholeForward is startBlackholeForward with connection limits on the forward
+func startLimitedBlackholeForward(t *testing.T, df *DynamicForwarder, limits ConnectionLimits) string {
+	t.Helper()
+
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	port := probe.Addr().(*net.TCPAddr).Port
+	probe.Close()
+
+	run := newHostRun(HostConfig{Name: "test"})
+	df.hostsMu.Lock()
+	df.runs = map[string]*hostRun{run.name: run}
+	df.hostsMu.Unlock()
+
+	cfg := NewForwardConfig(HostConfig{LocalIP: "127.0.0.1", JumpHost: "bastion.invalid", JumpPort: 22}, port)
+	cfg.ListenPort = port
+	rt := &forwardRuntime{conns: newConnLimiter(limits), faults: newFaultState(FaultConfig{Enabled: true, Blackhole: true}), run: run}
+
+	run.listeners.Add(1)
+	go df.listenAndForward(cfg, rt)
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			waitForActive(t, df, 0)
+			return addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Forward on %s never started listening", addr)
+	return ""
+}
+
+// waitForActive waits until the forwarder reports the given number of open connections
+func waitForActive(t *testing.T, df *DynamicForwarder, active int64) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if df.stats.Snapshot().ActiveConnections() == active {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("ActiveConnections() = %d, want %d", df.stats.Snapshot().ActiveConnections(), active)
+}
+
+func TestDrainWaitsForConnections(t *testing.T) {
+	df := &DynamicForwarder{stats: NewStats(), drainTimeout: 5 * time.Second}
+	addr := startBlackholeForward(t, df)
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	waitForActive(t, df, 1)
+
+	// The client finishes on its own well within the drain timeout
+	time.AfterFunc(50*time.Millisecond, func() { client.Close() })
+
+	start := time.Now()
+	df.drain(df.hostRuns())
+	elapsed := time.Since(start)
+
+	if elapsed < 40*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("drain() took %v, want it to return once the connection finished", elapsed)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Dial() after drain succeeded, want the listener to be closed")
+	}
+}
+
+func TestDrainTimeoutClosesConnections(t *testing.T) {
+	df := &DynamicForwarder{stats: NewStats(), drainTimeout: 50 * time.Millisecond}
+	addr := startBlackholeForward(t, df)
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+	waitForActive(t, df, 1)
+
+	df.drain(df.hostRuns())
+
+	if active := df.stats.Snapshot().ActiveConnections(); active != 0 {
+		t.Errorf("ActiveConnections() after drain = %d, want 0", active)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() succeeded, want the connection to be closed after the drain timeout")
+	}
+}
+
+func TestStopAbandonsStuckConnections(t *testing.T) {
+	defaultTimeout := connCloseTimeout
+	connCloseTimeout = 50 * time.Millisecond
+	defer func() { connCloseTimeout = defaultTimeout }()
+
+	df := &DynamicForwarder{stats: NewStats(), drainTimeout: 50 * time.Millisecond}
+	startBlackholeForward(t, df)
+
+	// A connection stuck in a call that ignores its context never finishes
+	runs := df.hostRuns()
+	runs[0].connections.Add(1)
+	defer runs[0].connections.Done()
+
+	done := make(chan struct{})
+	go func() {
+		df.drain(runs)
+		df.stopHost(runs[0])
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain() and stopHost() didn't return with a connection stuck")
+	}
+}
+
+func TestRejectedConnectionsNotCounted(t *testing.T) {
+	df := &DynamicForwarder{stats: NewStats(), drainTimeout: 50 * time.Millisecond}
+	sub := df.Subscribe(EventError, EventStatus)
+	defer sub.Close()
+	addr := startLimitedBlackholeForward(t, df, ConnectionLimits{MaxConnections: 1})
+	defer df.drain(df.hostRuns())
+
+	// Wait for the readiness probe's connection to finish so it doesn't hold the slot
+	for i := 0; i < 100; i++ {
+		if snapshot := df.stats.Snapshot(); len(snapshot.Forwards) == 1 && snapshot.Forwards[0].TotalConnections == 1 && snapshot.ActiveConnections() == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer first.Close()
+	waitForActive(t, df, 1)
+	total := df.stats.Snapshot().Forwards[0].TotalConnections
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Read() succeeded, want the connection over the limit to be closed")
+	}
+
+	fwd := df.stats.Snapshot().Forwards[0]
+	if fwd.Rejected != 1 || fwd.ActiveConnections != 1 || fwd.TotalConnections != total {
+		t.Errorf("stats = %+v, want 1 rejected and only the admitted connection counted", fwd)
+	}
+	select {
+	case event := <-sub.C:
+		t.Errorf("got %s event, want rejections not reported as errors", event.Type)
+	default:
+	}
+}
+
+func TestStatusEvents(t *testing.T) {
+	df := &DynamicForwarder{}
+
+	statusOnly := df.Subscribe(EventStatus)
+	all := df.Subscribe()
+	defer all.Close()
+
+	df.sendStatus(StatusUpdate{Health: StatusDegraded, Message: "first"})
+	for i, sub := range []*Subscription{statusOnly, all} {
+		event := receiveEvent(t, sub)
+		if event.Type != EventStatus || event.Health != StatusDegraded || event.Message != "first" {
+			t.Errorf("subscriber %d got %+v, want the degraded status", i, event)
+		}
+	}
+
+	statusOnly.Close()
+	statusOnly.Close()
+	if _, ok := <-statusOnly.C; ok {
+		t.Error("closed subscription channel should be closed")
+	}
+
+	df.sendStatus(StatusUpdate{Health: StatusHealthy})
+	if df.Health() != StatusHealthy {
+		t.Errorf("Health() = %v, want StatusHealthy", df.Health())
+	}
+}
+
+func TestStopAndRestart(t *testing.T) {
+	df := &DynamicForwarder{stats: NewStats(), sshPool: NewSSHClientPool(), drainTimeout: 50 * time.Millisecond}
+	sub := df.Subscribe(EventError, EventForwardStopped)
+	defer sub.Close()
+
+	cleanups := 0
+	for run := 0; run < 2; run++ {
+		addr := startBlackholeForward(t, df)
+		current := df.hostRuns()[0]
+		current.cleanup = append(current.cleanup, func() error {
+			cleanups++
+			return nil
+		})
+		df.setRunning(true)
+
+		client, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("run %d: Dial() error = %v", run, err)
+		}
+		waitForActive(t, df, 1)
+
+		if err := df.Stop(); err != nil {
+			t.Fatalf("run %d: Stop() error = %v", run, err)
+		}
+		client.Close()
+
+		if df.IsRunning() {
+			t.Errorf("run %d: IsRunning() = true after Stop()", run)
+		}
+		if cleanups != run+1 {
+			t.Errorf("run %d: cleanups ran %d times, want each cleanup to run exactly once", run, cleanups)
+		}
+	}
+
+	if err := df.Stop(); err != nil {
+		t.Errorf("Stop() on a stopped forwarder error = %v", err)
+	}
+
+	// Each run's listener reports stopping, and errors after stopping still reach subscribers
+	for run := 0; run < 2; run++ {
+		if event := receiveEvent(t, sub); event.Type != EventForwardStopped {
+			t.Errorf("got %s event, want %s", event.Type, EventForwardStopped)
+		}
+	}
+	df.recordError(net.ErrClosed)
+	if event := receiveEvent(t, sub); event.Type != EventError || event.Err != net.ErrClosed {
+		t.Errorf("got %+v, want the recorded error", event)
+	}
+}
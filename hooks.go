@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHookTimeout is how long a hook may run when timeout is unset
+	DefaultHookTimeout = 10 * time.Second
+
+	// maxConcurrentHooks bounds how many hook processes run at once; further events wait
+	// in the hook runner's event subscription
+	maxConcurrentHooks = 8
+)
+
+// HooksConfig holds shell commands to run when forwarder events happen
+type HooksConfig struct {
+	OnConnect    string        `yaml:"on_connect"`    // A local client connected
+	OnDisconnect string        `yaml:"on_disconnect"` // A local client's connection closed
+	OnSSHUp      string        `yaml:"on_ssh_up"`     // An SSH connection to a jump host was established
+	OnSSHDown    string        `yaml:"on_ssh_down"`   // An SSH connection to a jump host closed
+	OnError      string        `yaml:"on_error"`      // A connection could not be forwarded
+	Timeout      time.Duration `yaml:"timeout"`       // Kill hooks running longer than this (default: 10s)
+}
+
+// command returns the hook for an event type, if any
+func (h HooksConfig) command(eventType EventType) (name, command string) {
+	switch eventType {
+	case EventConnectionOpened:
+		return "on_connect", h.OnConnect
+	case EventConnectionClosed:
+		return "on_disconnect", h.OnDisconnect
+	case EventSSHConnected:
+		return "on_ssh_up", h.OnSSHUp
+	case EventSSHDisconnected:
+		return "on_ssh_down", h.OnSSHDown
+	case EventError:
+		return "on_error", h.OnError
+	}
+	return "", ""
+}
+
+// timeout returns the configured timeout or the default
+func (h HooksConfig) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return DefaultHookTimeout
+}
+
+// validate checks the hook settings; name prefixes error messages
+func (h HooksConfig) validate(name string) error {
+	if h.Timeout < 0 {
+		return fmt.Errorf("invalid %s.timeout: must not be negative", name)
+	}
+	return nil
+}
+
+// hookEventTypes are the events that can trigger hooks
+var hookEventTypes = []EventType{
+	EventConnectionOpened, EventConnectionClosed, EventSSHConnected, EventSSHDisconnected, EventError,
+}
+
+// hostHooks are a host's hooks along with what identifies its events
+type hostHooks struct {
+	hooks    HooksConfig
+	name     string // Host name, to match forward events
+	jumpAddr string // host:port, to match SSH events
+}
+
+// hook is a single command to run for an event
+type hook struct {
+	name    string
+	command string
+	timeout time.Duration
+}
+
+// hookRunner runs global and per-host hooks for forwarder events
+type hookRunner struct {
+	mu     sync.Mutex
+	global HooksConfig
+	hosts  []hostHooks // In config order
+
+	slots chan struct{}
+}
+
+// newHookRunner creates a runner with no hooks configured
+func newHookRunner() *hookRunner {
+	return &hookRunner{slots: make(chan struct{}, maxConcurrentHooks)}
+}
+
+// configure replaces the hooks with those from a freshly loaded config
+func (hr *hookRunner) configure(config *Config) {
+	hosts := make([]hostHooks, 0, len(config.Hosts))
+	for _, host := range config.Hosts {
+		hosts = append(hosts, hostHooks{
+			hooks:    host.Hooks,
+			name:     host.Name,
+			jumpAddr: fmt.Sprintf("%s:%d", host.JumpHost, host.JumpPort),
+		})
+	}
+
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	hr.global = config.Hooks
+	hr.hosts = hosts
+}
+
+// hooksFor returns the commands to run for an event: the global hook plus the hook of
+// every host the event concerns. SSH events concern all hosts using that jump host.
+// Identical commands only run once.
+func (hr *hookRunner) hooksFor(event Event) []hook {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	var hooks []hook
+	seen := make(map[string]bool)
+	add := func(config HooksConfig) {
+		name, command := config.command(event.Type)
+		if command == "" || seen[command] {
+			return
+		}
+		seen[command] = true
+		hooks = append(hooks, hook{name: name, command: command, timeout: config.timeout()})
+	}
+
+	add(hr.global)
+	sshEvent := event.Type == EventSSHConnected || event.Type == EventSSHDisconnected
+	for _, host := range hr.hosts {
+		if sshEvent && host.jumpAddr == event.JumpHost || !sshEvent && host.name == event.Name {
+			add(host.hooks)
+		}
+	}
+	return hooks
+}
+
+// run executes hooks for events from sub until the subscription is closed
+func (hr *hookRunner) run(sub *Subscription) {
+	for event := range sub.C {
+		for _, h := range hr.hooksFor(event) {
+			hr.slots <- struct{}{}
+			go func() {
+				defer func() { <-hr.slots }()
+				runHook(h, event)
+			}()
+		}
+	}
+}
+
+// runHook runs a hook's command with sh, describing the event in environment variables
+func runHook(h hook, event Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	logger := slog.With("hook", h.name, "command", h.command)
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.command)
+	cmd.Env = append(os.Environ(), hookEnv(h.name, event)...)
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		logger.Warn("Hook timed out", "timeout", h.timeout, "output", string(output))
+		return
+	}
+	if err != nil {
+		logger.Warn("Hook failed", "error", err, "output", string(output))
+		return
+	}
+	logger.Debug("Hook finished", "duration", time.Since(start), "output", string(output))
+}
+
+// hookEnv describes an event as PORTSMITH_* environment variables, omitting empty fields
+func hookEnv(name string, event Event) []string {
+	env := []string{
+		"PORTSMITH_HOOK=" + name,
+		"PORTSMITH_EVENT=" + string(event.Type),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+
+	add("PORTSMITH_HOST_NAME", event.Name)
+	add("PORTSMITH_HOST", event.Host)
+	if event.Port != 0 {
+		add("PORTSMITH_PORT", strconv.Itoa(event.Port))
+	}
+	add("PORTSMITH_LISTEN", event.Listen)
+	add("PORTSMITH_REMOTE", event.Remote)
+	add("PORTSMITH_JUMP_HOST", event.JumpHost)
+	add("PORTSMITH_CLIENT", event.Client)
+	if event.ConnID != 0 {
+		add("PORTSMITH_CONN_ID", strconv.FormatUint(event.ConnID, 10))
+	}
+	if event.Type == EventConnectionClosed {
+		add("PORTSMITH_REASON", event.Reason)
+		add("PORTSMITH_DURATION_MS", strconv.FormatInt(event.Duration.Milliseconds(), 10))
+		add("PORTSMITH_BYTES_IN", strconv.FormatInt(event.BytesIn, 10))
+		add("PORTSMITH_BYTES_OUT", strconv.FormatInt(event.BytesOut, 10))
+	}
+	if event.Err != nil {
+		add("PORTSMITH_ERROR", event.Err.Error())
+	}
+	return env
+}
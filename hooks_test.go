@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooksFor(t *testing.T) {
+	hr := newHookRunner()
+	hr.configure(&Config{
+		Hooks: HooksConfig{OnConnect: "global-connect", OnSSHUp: "global-up", Timeout: time.Minute},
+		Hosts: []HostConfig{
+			{Name: "db", LocalIP: "127.0.0.2", JumpHost: "bastion", JumpPort: 22, Hooks: HooksConfig{OnConnect: "db-connect", OnSSHUp: "db-up"}},
+			{Name: "api", LocalIP: "127.0.0.3", JumpHost: "bastion", JumpPort: 22, Hooks: HooksConfig{OnSSHUp: "global-up", OnError: "api-error"}},
+			{Name: "cache", LocalIP: "127.0.0.4", JumpHost: "other", JumpPort: 22, Hooks: HooksConfig{OnSSHUp: "other-up"}},
+			{Name: "admin", LocalIP: "127.0.0.2", JumpHost: "bastion", JumpPort: 22, Hooks: HooksConfig{OnError: "admin-error"}},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		event Event
+		want  []string
+	}{
+		{"global and host hook", Event{Type: EventConnectionOpened, Name: "db", Host: "127.0.0.2"}, []string{"global-connect", "db-connect"}},
+		{"global hook only", Event{Type: EventConnectionOpened, Name: "api", Host: "127.0.0.3"}, []string{"global-connect"}},
+		{"host hook only", Event{Type: EventError, Name: "api", Host: "127.0.0.3"}, []string{"api-error"}},
+		{"no hook", Event{Type: EventConnectionClosed, Name: "db", Host: "127.0.0.2"}, nil},
+		{"only the host's own hook on a shared local IP", Event{Type: EventError, Name: "admin", Host: "127.0.0.2"}, []string{"admin-error"}},
+		{"unhooked event type", Event{Type: EventStatus}, nil},
+		{"ssh event for every host on the jump host, deduplicated", Event{Type: EventSSHConnected, JumpHost: "bastion:22"}, []string{"global-up", "db-up"}},
+		{"ssh event on another jump host", Event{Type: EventSSHConnected, JumpHost: "other:22"}, []string{"global-up", "other-up"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, h := range hr.hooksFor(tt.event) {
+				got = append(got, h.command)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("hooksFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Host hooks use their own timeout, falling back to the default rather than the global one
+	hooks := hr.hooksFor(Event{Type: EventConnectionOpened, Name: "db", Host: "127.0.0.2"})
+	if hooks[0].timeout != time.Minute || hooks[1].timeout != DefaultHookTimeout {
+		t.Errorf("timeouts = %v, %v, want %v, %v", hooks[0].timeout, hooks[1].timeout, time.Minute, DefaultHookTimeout)
+	}
+}
+
+func TestHookEnv(t *testing.T) {
+	env := hookEnv("on_disconnect", Event{
+		Type:     EventConnectionClosed,
+		Name:     "db",
+		Host:     "127.0.0.2",
+		Port:     5432,
+		Listen:   "127.0.0.2:5432",
+		Remote:   "db.internal:5432",
+		JumpHost: "bastion:22",
+		ConnID:   7,
+		Client:   "psql",
+		Duration: 1500 * time.Millisecond,
+		BytesIn:  10,
+		Reason:   CloseClientClosed,
+	})
+
+	for _, want := range []string{
+		"PORTSMITH_HOOK=on_disconnect",
+		"PORTSMITH_EVENT=connection_closed",
+		"PORTSMITH_HOST_NAME=db",
+		"PORTSMITH_HOST=127.0.0.2",
+		"PORTSMITH_PORT=5432",
+		"PORTSMITH_LISTEN=127.0.0.2:5432",
+		"PORTSMITH_REMOTE=db.internal:5432",
+		"PORTSMITH_JUMP_HOST=bastion:22",
+		"PORTSMITH_CONN_ID=7",
+		"PORTSMITH_CLIENT=psql",
+		"PORTSMITH_REASON=client_closed",
+		"PORTSMITH_DURATION_MS=1500",
+		"PORTSMITH_BYTES_IN=10",
+		"PORTSMITH_BYTES_OUT=0",
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("hookEnv() missing %s", want)
+		}
+	}
+
+	env = hookEnv("on_ssh_down", Event{Type: EventSSHDisconnected, JumpHost: "bastion:22", Err: errors.New("EOF")})
+	if !slices.Contains(env, "PORTSMITH_ERROR=EOF") {
+		t.Errorf("hookEnv() = %v, want PORTSMITH_ERROR", env)
+	}
+	for _, v := range env {
+		if strings.HasPrefix(v, "PORTSMITH_PORT=") || strings.HasPrefix(v, "PORTSMITH_BYTES_IN=") {
+			t.Errorf("hookEnv() included %s for an SSH event", v)
+		}
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	runHook(hook{name: "on_connect", command: `echo "$PORTSMITH_EVENT $PORTSMITH_HOST" > ` + out, timeout: 5 * time.Second},
+		Event{Type: EventConnectionOpened, Host: "127.0.0.2"})
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "connection_opened 127.0.0.2" {
+		t.Errorf("hook output = %q", got)
+	}
+
+	start := time.Now()
+	runHook(hook{name: "on_connect", command: "sleep 10", timeout: 50 * time.Millisecond}, Event{Type: EventConnectionOpened})
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("runHook() took %v, want the hook to be killed after its timeout", elapsed)
+	}
+}
+
+func TestHookRunnerRun(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	hr := newHookRunner()
+	hr.configure(&Config{Hooks: HooksConfig{OnError: `echo "$PORTSMITH_ERROR" > ` + out}})
+
+	var bus EventBus
+	sub := bus.Subscribe(hookEventTypes...)
+	go hr.run(sub)
+	defer sub.Close()
+
+	bus.Publish(Event{Type: EventError, Err: errors.New("dial failed")})
+	for i := 0; i < 200; i++ {
+		if data, err := os.ReadFile(out); err == nil && strings.TrimSpace(string(data)) == "dial failed" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("on_error hook did not run")
+}
+
+func TestLoadConfigHooks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `hooks:
+  on_ssh_down: notify-send "tunnel down"
+  timeout: 30s
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: db.example.com
+    jump_host: bastion.example.com
+    hooks:
+      on_connect: ./warm-cache.sh
+    ports: [5432]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.Hooks.OnSSHDown != `notify-send "tunnel down"` || config.Hooks.Timeout != 30*time.Second {
+		t.Errorf("global hooks = %+v", config.Hooks)
+	}
+	if config.Hosts[0].Hooks.OnConnect != "./warm-cache.sh" {
+		t.Errorf("host hooks = %+v", config.Hosts[0].Hooks)
+	}
+
+	if err := os.WriteFile(path, []byte("hooks:\n  timeout: -1s\nhosts:\n  - local_ip: 127.0.0.2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig() should reject a negative hook timeout")
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connCloseTimeout is how long stopping waits for connections to finish once they've been
+// closed, before abandoning them
+var connCloseTimeout = 5 * time.Second
+
+// hostRun is the lifecycle of one forwarded host: cancelling stopListening closes its
+// listeners, cancelling closeConns force-closes the connections still open after draining
+type hostRun struct {
+	name          string
+	config        HostConfig // Config the host was started with
+	listenCtx     context.Context
+	connCtx       context.Context
+	stopListening context.CancelFunc
+	closeConns    context.CancelFunc
+	listeners     sync.WaitGroup
+	connections   sync.WaitGroup
+	cleanup       []func() error // Network state set up for the host, undone in reverse
+	faults        *faultState
+}
+
+// newHostRun creates the lifecycle for a host that is about to start forwarding
+func newHostRun(cfg HostConfig) *hostRun {
+	run := &hostRun{name: cfg.Name, config: cfg}
+	run.listenCtx, run.stopListening = context.WithCancel(context.Background())
+	run.connCtx, run.closeConns = context.WithCancel(context.Background())
+	return run
+}
+
+// loopbackAlias is a loopback alias shared by every running host with the same local IP
+type loopbackAlias struct {
+	refs   int
+	remove func() error
+}
+
+// HostStatus describes a configured host and whether it is being forwarded
+type HostStatus struct {
+	Name    string
+	Enabled bool // Enabled by the config or a runtime override
+	Running bool // Listening in the current run
+}
+
+// Hosts returns the status of every configured host, in config order
+func (df *DynamicForwarder) Hosts() []HostStatus {
+	df.hostsMu.Lock()
+	defer df.hostsMu.Unlock()
+
+	hosts := make([]HostStatus, 0, len(df.configs))
+	for _, cfg := range df.configs {
+		_, running := df.runs[cfg.Name]
+		hosts = append(hosts, HostStatus{
+			Name:    cfg.Name,
+			Enabled: df.state.hostEnabled(cfg),
+			Running: running,
+		})
+	}
+	return hosts
+}
+
+// SetHostEnabled enables or disables a single host, bringing its listeners, loopback
+// alias, /etc/hosts entries and pf redirects up or down if the forwarder is running. The
+// choice is saved to the state file and overrides the host's enabled setting on restart.
+func (df *DynamicForwarder) SetHostEnabled(name string, enabled bool) error {
+	df.lifecycleMu.Lock()
+	defer df.lifecycleMu.Unlock()
+
+	var cfg HostConfig
+	found := false
+	for _, host := range df.configs {
+		if host.Name == name {
+			cfg, found = host, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown host %q", name)
+	}
+
+	if err := df.loadState(); err != nil {
+		return err
+	}
+
+	if df.IsRunning() {
+		df.hostsMu.Lock()
+		run, active := df.runs[name]
+		df.hostsMu.Unlock()
+
+		switch {
+		case enabled && !active:
+			if err := df.startHost(cfg, false); err != nil {
+				return fmt.Errorf("failed to enable host %s: %w", name, err)
+			}
+		case !enabled && active:
+			df.drain([]*hostRun{run})
+			df.stopHost(run)
+		}
+	}
+
+	df.hostsMu.Lock()
+	df.state.setHostEnabled(cfg, enabled)
+	df.hostsMu.Unlock()
+	if err := df.state.Save(df.statePath); err != nil {
+		return err
+	}
+
+	slog.Info("Host toggled", "host", name, "enabled", enabled)
+	return nil
+}
+
+// loadState reads the state file if it hasn't been read yet by starting the forwarder
+func (df *DynamicForwarder) loadState() error {
+	if df.state != nil {
+		return nil
+	}
+
+	state, err := LoadState(df.statePath)
+	if err != nil {
+		return err
+	}
+	df.hostsMu.Lock()
+	df.state = state
+	df.hostsMu.Unlock()
+	return nil
+}
+
+// applyHosts switches to the hosts, and their hooks, of a freshly loaded config
+func (df *DynamicForwarder) applyHosts(config *Config) {
+	df.hostsMu.Lock()
+	df.configs = config.Hosts
+	df.profiles = config.ProfileNames()
+	df.active = config.Profile
+	df.hostsMu.Unlock()
+
+	if df.hooks != nil {
+		df.hooks.configure(config)
+	}
+}
+
+// StartHosts forwards only the given hosts, with config's global settings. Unlike Start, it
+// neither reloads the config nor cleans up stale network state first, since that may belong
+// to a tray app running alongside. Loopback aliases, hosts entries and pf redirects that
+// already exist are used as they are, and Stop only tears down what the hosts set up themselves.
+func (df *DynamicForwarder) StartHosts(config *Config, hosts []HostConfig) error {
+	df.lifecycleMu.Lock()
+	defer df.lifecycleMu.Unlock()
+
+	if df.IsRunning() {
+		return fmt.Errorf("forwarder is already running")
+	}
+
+	selected := *config
+	selected.Hosts = hosts
+	df.applyHosts(&selected)
+	df.jumpHostLimits = config.JumpHostLimits
+	df.bandwidthLimit = config.BandwidthLimit
+	df.drainTimeout = config.DrainTimeout
+	df.resetRun()
+
+	for _, cfg := range hosts {
+		if err := df.startHost(cfg, true); err != nil {
+			df.teardown()
+			return err
+		}
+	}
+
+	df.setRunning(true)
+	df.clearErrors()
+	df.sendStatus(StatusUpdate{Health: StatusHealthy, Message: "Port forwarding started"})
+	return nil
+}
+
+// reconcileHosts brings the running hosts in line with the current configs. Hosts that
+// were removed, disabled or changed are drained and stopped, then new and changed hosts
+// are started. Hosts whose config is unchanged keep forwarding undisturbed.
+func (df *DynamicForwarder) reconcileHosts() error {
+	desired := make(map[string]bool, len(df.configs))
+	configs := make(map[string]HostConfig, len(df.configs))
+	for _, cfg := range df.configs {
+		desired[cfg.Name] = df.state.hostEnabled(cfg)
+		configs[cfg.Name] = cfg
+	}
+
+	var stale []*hostRun
+	for _, run := range df.hostRuns() {
+		if !desired[run.name] || !reflect.DeepEqual(configs[run.name], run.config) {
+			stale = append(stale, run)
+		}
+	}
+	if len(stale) > 0 {
+		df.drain(stale)
+		for _, run := range stale {
+			df.stopHost(run)
+		}
+	}
+
+	var errs []error
+	for _, cfg := range df.configs {
+		df.hostsMu.Lock()
+		_, running := df.runs[cfg.Name]
+		df.hostsMu.Unlock()
+
+		if desired[cfg.Name] && !running {
+			if err := df.startHost(cfg, false); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hostRuns returns the hosts forwarded in the current run
+func (df *DynamicForwarder) hostRuns() []*hostRun {
+	df.hostsMu.Lock()
+	defer df.hostsMu.Unlock()
+
+	runs := make([]*hostRun, 0, len(df.runs))
+	for _, run := range df.runs {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// startHost sets up network state and listeners for a single host. Anything already set
+// up is torn down again if it fails. With keepExisting, aliases, hosts entries and pf
+// redirects that existed before the host started are used as they are and left in place
+// when it stops, as they may belong to a tray app running alongside.
+func (df *DynamicForwarder) startHost(cfg HostConfig, keepExisting bool) (err error) {
+	run := newHostRun(cfg)
+	df.hostsMu.Lock()
+	if df.runs == nil {
+		df.runs = make(map[string]*hostRun)
+	}
+	df.runs[cfg.Name] = run
+	df.hostsMu.Unlock()
+
+	defer func() {
+		if err != nil {
+			df.stopHost(run)
+		}
+	}()
+
+	if cfg.LocalIP != "" {
+		release, err := df.acquireAlias(cfg.LocalIP, keepExisting)
+		if err != nil {
+			return fmt.Errorf("failed to setup loopback for %s: %w", cfg.LocalIP, err)
+		}
+		run.cleanup = append(run.cleanup, release)
+	}
+
+	hostnames := cfg.Hostnames
+	if keepExisting {
+		hostnames = missingHostsEntries(cfg.LocalIP, hostnames)
+	}
+	cleanup, err := df.netSetup.AddHostsEntries(cfg.LocalIP, hostnames)
+	if err != nil {
+		return fmt.Errorf("failed to setup hosts entries for %s: %w", cfg.LocalIP, err)
+	}
+	run.cleanup = append(run.cleanup, cleanup)
+
+	target := cfg.RemoteHost
+	if cfg.RemoteSocket != "" {
+		target = fmt.Sprintf("%s:%s", cfg.JumpHost, cfg.RemoteSocket)
+	}
+	displayName := target
+	if len(cfg.Hostnames) > 0 {
+		displayName = fmt.Sprintf("%s (%s)", strings.Join(cfg.Hostnames, ", "), target)
+	}
+
+	forwards, err := ExpandForwards(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to expand ports for %s: %w", displayName, err)
+	}
+
+	if len(forwards) == 0 {
+		slog.Warn("Host has no ports configured - skipping", "host", displayName)
+		return nil
+	}
+
+	slog.Info("Setting up forwards", "local_ip", cfg.LocalIP, "host", displayName, "forwards", len(forwards))
+
+	// Bandwidth buckets are shared by every connection to this host
+	hostUp := newTokenBucket(cfg.BandwidthLimit.Up)
+	hostDown := newTokenBucket(cfg.BandwidthLimit.Down)
+
+	run.faults = newFaultState(cfg.Faults)
+	df.faultsMu.Lock()
+	if df.faults == nil {
+		df.faults = make(map[string]*faultState)
+	}
+	df.faults[run.name] = run.faults
+	df.faultsMu.Unlock()
+	if _, active := run.faults.active(); active {
+		slog.Warn("Fault injection enabled", "host", displayName)
+	}
+
+	for _, fwdCfg := range forwards {
+		if fwdCfg.ListenSocket != "" {
+			socketPath, err := resolveSocketPath(fwdCfg.ListenSocket)
+			if err != nil {
+				return fmt.Errorf("failed to resolve socket path %s: %w", fwdCfg.ListenSocket, err)
+			}
+			fwdCfg.ListenSocket = socketPath
+			// The socket may now belong to another instance, which keeps it
+			run.cleanup = append(run.cleanup, func() error {
+				if err := removeStaleSocket(socketPath); !errors.Is(err, errSocketInUse) {
+					return err
+				}
+				return nil
+			})
+		}
+
+		if fwdCfg.NeedsPFRedirect() && keepExisting && pfRedirectExists(fwdCfg.LocalIP, fwdCfg.Port, fwdCfg.ListenPort) {
+			slog.Info("Using existing pf redirect", "local_ip", fwdCfg.LocalIP, "port", fwdCfg.Port)
+		} else if fwdCfg.NeedsPFRedirect() {
+			cleanup, err := df.netSetup.SetupPFRedirect(fwdCfg.LocalIP, fwdCfg.Port, fwdCfg.ListenPort)
+			if err != nil {
+				return fmt.Errorf("failed to setup pf redirect for %s:%d: %w", fwdCfg.LocalIP, fwdCfg.Port, err)
+			}
+			run.cleanup = append(run.cleanup, cleanup)
+		}
+
+		run.listeners.Add(1)
+		go df.listenAndForward(fwdCfg, &forwardRuntime{
+			conns:  newConnLimiter(fwdCfg.Limits),
+			up:     []*tokenBucket{hostUp, df.globalUp},
+			down:   []*tokenBucket{hostDown, df.globalDown},
+			faults: run.faults,
+			run:    run,
+		})
+	}
+
+	return nil
+}
+
+// stopHost closes a host's listeners and connections without draining, then undoes its
+// network setup
+func (df *DynamicForwarder) stopHost(run *hostRun) {
+	run.stopListening()
+	run.closeConns()
+	run.listeners.Wait()
+	waitClosed([]*hostRun{run}, nil)
+
+	for i := len(run.cleanup) - 1; i >= 0; i-- {
+		if err := run.cleanup[i](); err != nil {
+			slog.Error("Cleanup error", "host", run.name, "error", err)
+		}
+	}
+	run.cleanup = nil
+
+	df.hostsMu.Lock()
+	if df.runs[run.name] == run {
+		delete(df.runs, run.name)
+	}
+	df.hostsMu.Unlock()
+
+	df.faultsMu.Lock()
+	if run.faults != nil && df.faults[run.name] == run.faults {
+		delete(df.faults, run.name)
+	}
+	df.faultsMu.Unlock()
+}
+
+// waitClosed waits for the connections of runs whose connections have been closed to
+// finish, or takes done to signal that they have. A connection stuck in a call that can't
+// be interrupted is abandoned after connCloseTimeout, so stopping never hangs.
+func waitClosed(runs []*hostRun, done <-chan struct{}) {
+	if done == nil {
+		finished := make(chan struct{})
+		go func() {
+			for _, run := range runs {
+				run.connections.Wait()
+			}
+			close(finished)
+		}()
+		done = finished
+	}
+
+	timer := time.NewTimer(connCloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		slog.Warn("Abandoning connections that didn't finish after being closed", "timeout", connCloseTimeout)
+	}
+}
+
+// acquireAlias creates the loopback alias for ip unless another running host already has,
+// returning a function that removes it once the last host using it stops. With keepExisting,
+// an alias that already exists is used and never removed.
+func (df *DynamicForwarder) acquireAlias(ip string, keepExisting bool) (func() error, error) {
+	// 127.0.0.1 and ::1 always exist
+	if ip == "127.0.0.1" || ip == "::1" {
+		return func() error { return nil }, nil
+	}
+
+	alias, exists := df.aliases[ip]
+	if !exists {
+		remove := func() error { return nil }
+		if keepExisting && loopbackAliasExists(ip) {
+			slog.Info("Using existing loopback alias", "local_ip", ip)
+		} else {
+			var err error
+			if remove, err = df.netSetup.SetupLoopbackAlias(ip); err != nil {
+				return nil, err
+			}
+		}
+		alias = &loopbackAlias{remove: remove}
+		if df.aliases == nil {
+			df.aliases = make(map[string]*loopbackAlias)
+		}
+		df.aliases[ip] = alias
+	}
+	alias.refs++
+
+	return func() error {
+		alias.refs--
+		if alias.refs > 0 {
+			return nil
+		}
+		delete(df.aliases, ip)
+		return alias.remove()
+	}, nil
+}
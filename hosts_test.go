@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a loopback TCP port that was free a moment ago
+func freePort(t *testing.T) int {
+	t.Helper()
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer probe.Close()
+	return probe.Addr().(*net.TCPAddr).Port
+}
+
+// waitForListening waits until addr accepts (want) or refuses (!want) connections
+func waitForListening(t *testing.T, addr string, want bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		if (err == nil) == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("listening on %s = %v, want %v", addr, !want, want)
+}
+
+func TestSetHostEnabled(t *testing.T) {
+	dir := t.TempDir()
+	dbPort, apiPort := freePort(t), freePort(t)
+	// 127.0.0.1 without hostnames needs no helper calls, so the hosts can run for real.
+	// Blackholed connections stay open without an SSH server.
+	blackhole := FaultConfig{Enabled: true, Blackhole: true}
+	hosts := []HostConfig{
+		{Name: "db", LocalIP: "127.0.0.1", RemoteHost: "db.invalid", JumpHost: "bastion.invalid", JumpPort: 22, Ports: []interface{}{dbPort}, Faults: blackhole},
+		{Name: "api", LocalIP: "127.0.0.1", RemoteHost: "api.invalid", JumpHost: "bastion.invalid", JumpPort: 22, Ports: []interface{}{apiPort}, Faults: blackhole, Enabled: boolPtr(false)},
+	}
+	df := &DynamicForwarder{
+		configs:      hosts,
+		statePath:    filepath.Join(dir, StateFileName),
+		netSetup:     &NetworkSetup{},
+		sshPool:      NewSSHClientPool(),
+		stats:        NewStats(),
+		drainTimeout: 50 * time.Millisecond,
+	}
+	df.setRunning(true)
+	defer df.Close()
+
+	dbAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(dbPort))
+	apiAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(apiPort))
+
+	if err := df.SetHostEnabled("api", true); err != nil {
+		t.Fatalf("SetHostEnabled(api, true) error = %v", err)
+	}
+	waitForListening(t, apiAddr, true)
+
+	if err := df.SetHostEnabled("db", true); err != nil {
+		t.Fatalf("SetHostEnabled(db, true) error = %v", err)
+	}
+	waitForListening(t, dbAddr, true)
+
+	// Hosts sharing a local IP keep their own fault settings
+	if faults := df.Faults(); len(faults) != 2 || !faults["db"].Blackhole || !faults["api"].Blackhole {
+		t.Errorf("Faults() = %+v, want settings for db and api", faults)
+	}
+
+	// Disabling one host leaves the other forwarding
+	if err := df.SetHostEnabled("db", false); err != nil {
+		t.Fatalf("SetHostEnabled(db, false) error = %v", err)
+	}
+	waitForListening(t, dbAddr, false)
+	waitForListening(t, apiAddr, true)
+
+	want := []HostStatus{{Name: "db", Enabled: false}, {Name: "api", Enabled: true, Running: true}}
+	for i, host := range df.Hosts() {
+		if host != want[i] {
+			t.Errorf("Hosts()[%d] = %+v, want %+v", i, host, want[i])
+		}
+	}
+
+	// Both toggles differ from the config, so both survive a restart
+	state, err := LoadState(df.statePath)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if state.hostEnabled(hosts[0]) || !state.hostEnabled(hosts[1]) {
+		t.Errorf("saved state = %+v, want db disabled and api enabled", state.Hosts)
+	}
+
+	if err := df.SetHostEnabled("cache", true); err == nil {
+		t.Error("SetHostEnabled() should reject an unknown host")
+	}
+}
+
+func TestAcquireAliasShared(t *testing.T) {
+	removed := 0
+	df := &DynamicForwarder{aliases: map[string]*loopbackAlias{
+		"127.0.0.2": {remove: func() error { removed++; return nil }},
+	}}
+
+	first, err := df.acquireAlias("127.0.0.2", false)
+	if err != nil {
+		t.Fatalf("acquireAlias() error = %v", err)
+	}
+	second, err := df.acquireAlias("127.0.0.2", false)
+	if err != nil {
+		t.Fatalf("acquireAlias() error = %v", err)
+	}
+
+	first()
+	if removed != 0 {
+		t.Error("alias removed while another host still uses it")
+	}
+	second()
+	if removed != 1 || len(df.aliases) != 0 {
+		t.Errorf("alias removed %d times, %d aliases left; want it removed once by the last host", removed, len(df.aliases))
+	}
+}
+
+func TestMissingHostsEntries(t *testing.T) {
+	hostsPath = filepath.Join(t.TempDir(), "hosts")
+	defer func() { hostsPath = "/etc/hosts" }()
+	content := "127.0.0.1 localhost\n127.0.0.2 db.local db # portsmith-dynamic-forward\n# 127.0.0.2 api.local\n127.0.0.3 cache.local\n"
+	if err := os.WriteFile(hostsPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := missingHostsEntries("127.0.0.2", []string{"db.local", "api.local", "cache.local", "db"})
+	if want := []string{"api.local", "cache.local"}; !slices.Equal(got, want) {
+		t.Errorf("missingHostsEntries() = %v, want %v", got, want)
+	}
+}
+
+func TestAcquireAliasKeepsExisting(t *testing.T) {
+	var ip string
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && !ipNet.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+			ip = ipNet.IP.String()
+			break
+		}
+	}
+	if ip == "" {
+		t.Skip("no interface address besides 127.0.0.1")
+	}
+
+	// Without a helper, creating or removing the alias would fail
+	df := &DynamicForwarder{netSetup: &NetworkSetup{}}
+	release, err := df.acquireAlias(ip, true)
+	if err != nil {
+		t.Fatalf("acquireAlias(%s) error = %v, want the existing address used", ip, err)
+	}
+	if err := release(); err != nil {
+		t.Errorf("release() error = %v, want the existing address kept", err)
+	}
+}
+
+func TestStartHostKeepsExistingPFRedirect(t *testing.T) {
+	pfAnchorPath = filepath.Join(t.TempDir(), "portsmith")
+	defer func() { pfAnchorPath = "/etc/pf.anchors/portsmith" }()
+	rule := "rdr pass on lo0 inet proto tcp from any to 127.0.0.1 port 1023 -> 127.0.0.1 port 11023\n"
+	if err := os.WriteFile(pfAnchorPath, []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a helper, adding or removing the redirect would fail
+	df := &DynamicForwarder{netSetup: &NetworkSetup{timings: make(map[string]HelperTiming)}, sshPool: NewSSHClientPool(), stats: NewStats()}
+	host := HostConfig{Name: "web", LocalIP: "127.0.0.1", RemoteHost: "web.invalid", JumpHost: "bastion.invalid", JumpPort: 22, Ports: []interface{}{1023}}
+	if err := df.startHost(host, true); err != nil {
+		t.Fatalf("startHost() error = %v, want the existing redirect used", err)
+	}
+	run := df.hostRuns()[0]
+	df.stopHost(run)
+	if len(df.hostRuns()) != 0 {
+		t.Error("stopHost() left the host running")
+	}
+}
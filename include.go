@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DropInDir is the directory, next to the config file and the global config, whose *.yaml
+// files are merged into the config automatically
+const DropInDir = "conf.d"
+
+// globalDropInDir holds personal drop-ins, merged into every config loaded
+var globalDropInDir = filepath.Join(filepath.Dir(GlobalConfigPath), DropInDir)
+
+// hostNode is a host's settings along with the files that define them
+type hostNode struct {
+	node      *yaml.Node
+	file      string   // The last file to define the host
+	positions []string // file:line of the host in each file, starting with the one that added it
+}
+
+// source names the files and lines a host is defined at, for error messages
+func (h hostNode) source() string {
+	return strings.Join(h.positions, ", ")
+}
+
+// hostList is a list of hosts merged from one or more files
+type hostList []hostNode
+
+// add appends a host, or merges it over a host with the same explicit name from an earlier
+// file. Hosts sharing a name within one file are kept apart so validation reports them.
+func (l *hostList) add(node *yaml.Node, file string) {
+	position := fmt.Sprintf("%s:%d", file, node.Line)
+	if name := scalarValue(node, "name"); name != "" {
+		for i, existing := range *l {
+			if scalarValue(existing.node, "name") == name && existing.file != file {
+				(*l)[i].node = mergeMappings(existing.node, node)
+				(*l)[i].file = file
+				(*l)[i].positions = append(existing.positions, position)
+				return
+			}
+		}
+	}
+	*l = append(*l, hostNode{node: node, file: file, positions: []string{position}})
+}
+
+// profileDocument is a profile merged from every file that defines it
+type profileDocument struct {
+	settings *yaml.Node // Mapping of the profile's keys other than hosts
+	hosts    hostList
+}
+
+// configDocument is a config file merged with the files it includes and the drop-in
+// directory. Files are merged in order: the main file, its includes in the order listed
+// (matches of each glob sorted by name), then conf.d/*.yaml sorted by name. Hosts are
+// appended, or merged over an earlier host with the same name. Profiles with the same
+// name are merged the same way. defaults and templates are merged key by key. Any other
+// setting in a later file replaces the earlier value.
+type configDocument struct {
+	settings     *yaml.Node // Mapping of top-level keys other than hosts and profiles
+	hosts        hostList
+	profiles     map[string]*profileDocument
+	profileOrder []string
+	loaded       map[string]bool // Absolute paths already merged, so each file is read once
+	problems     []error         // Unknown settings, reported along with the config's other problems
+}
+
+// loadConfigDocument reads a config file, its includes and the drop-in directories: the one
+// next to the config, then the global one, so personal drop-ins take precedence
+func loadConfigDocument(path string) (*configDocument, error) {
+	doc := &configDocument{
+		settings: &yaml.Node{Kind: yaml.MappingNode},
+		profiles: make(map[string]*profileDocument),
+		loaded:   make(map[string]bool),
+	}
+
+	if err := doc.load(path, true); err != nil {
+		return nil, err
+	}
+
+	globalDir, err := ExpandKeyPath(globalDropInDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand %s: %w", globalDropInDir, err)
+	}
+	// Files already merged are skipped, so the global config's drop-ins are read once
+	for _, dir := range []string{filepath.Join(filepath.Dir(path), DropInDir), globalDir} {
+		dropIns, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, dropIn := range dropIns {
+			if err := doc.load(dropIn, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return doc, nil
+}
+
+// load merges a file and, recursively, the files it includes. Files already merged are
+// skipped, which also stops include cycles.
+func (d *configDocument) load(path string, main bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if d.loaded[abs] {
+		return nil
+	}
+	d.loaded[abs] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if main {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		return fmt.Errorf("failed to read included config file: %w", err)
+	}
+
+	var file yaml.Node
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if len(file.Content) == 0 {
+		return nil
+	}
+	root := file.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("failed to parse config %s: must be a mapping of settings", path)
+	}
+
+	d.problems = append(d.problems, checkKnownKeys(root, path)...)
+	if err := d.merge(root, path); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var includes struct {
+		Include []string `yaml:"include"`
+	}
+	if err := root.Decode(&includes); err != nil {
+		return fmt.Errorf("failed to parse config %s: include must be a list of paths: %w", path, err)
+	}
+	for _, pattern := range includes.Include {
+		matches, err := expandInclude(filepath.Dir(path), pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, match := range matches {
+			if err := d.load(match, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandInclude resolves an include pattern relative to dir. Patterns without wildcards
+// must name an existing file; globs may match nothing.
+func expandInclude(dir, pattern string) ([]string, error) {
+	expanded, err := ExpandKeyPath(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(dir, expanded)
+	}
+
+	if !strings.ContainsAny(expanded, "*?[") {
+		if _, err := os.Stat(expanded); err != nil {
+			return nil, fmt.Errorf("include %q: %w", pattern, err)
+		}
+		return []string{expanded}, nil
+	}
+
+	matches, err := filepath.Glob(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include %q: %w", pattern, err)
+	}
+	return matches, nil
+}
+
+// merge adds the top-level settings of one file
+func (d *configDocument) merge(root *yaml.Node, file string) error {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "include":
+		case "hosts":
+			if err := addHosts(&d.hosts, value, file); err != nil {
+				return err
+			}
+		case "profiles":
+			if err := d.mergeProfiles(value, file); err != nil {
+				return err
+			}
+		case "defaults", "templates":
+			setMappingValue(d.settings, key, mergeMappings(mappingValue(d.settings, key.Value), value))
+		default:
+			setMappingValue(d.settings, key, value)
+		}
+	}
+	return nil
+}
+
+// mergeProfiles adds the profiles of one file
+func (d *configDocument) mergeProfiles(profiles *yaml.Node, file string) error {
+	if profiles.Kind == yaml.ScalarNode && profiles.Tag == "!!null" {
+		return nil
+	}
+	if profiles.Kind != yaml.MappingNode {
+		return fmt.Errorf("profiles must be a mapping of profile names to profiles")
+	}
+
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name, value := profiles.Content[i].Value, profiles.Content[i+1]
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("profile %s: must be a mapping", name)
+		}
+
+		profile, exists := d.profiles[name]
+		if !exists {
+			profile = &profileDocument{settings: &yaml.Node{Kind: yaml.MappingNode}}
+			d.profiles[name] = profile
+			d.profileOrder = append(d.profileOrder, name)
+		}
+
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			key, setting := value.Content[j], value.Content[j+1]
+			switch key.Value {
+			case "hosts":
+				if err := addHosts(&profile.hosts, setting, file); err != nil {
+					return fmt.Errorf("profile %s: %w", name, err)
+				}
+			case "defaults":
+				setMappingValue(profile.settings, key, mergeMappings(mappingValue(profile.settings, key.Value), setting))
+			default:
+				setMappingValue(profile.settings, key, setting)
+			}
+		}
+	}
+	return nil
+}
+
+// addHosts adds the host nodes of a hosts sequence to a list
+func addHosts(list *hostList, hosts *yaml.Node, file string) error {
+	if hosts.Kind == yaml.ScalarNode && hosts.Tag == "!!null" {
+		return nil
+	}
+	if hosts.Kind != yaml.SequenceNode {
+		return fmt.Errorf("hosts must be a list")
+	}
+	for _, host := range hosts.Content {
+		list.add(host, file)
+	}
+	return nil
+}
+
+// settingsNode builds the merged settings as a single YAML mapping. Hosts are left out
+// since they're resolved separately, with the files they come from.
+func (d *configDocument) settingsNode() *yaml.Node {
+	profiles := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range d.profileOrder {
+		profiles.Content = append(profiles.Content, scalarNode(name), d.profiles[name].settings)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Content: append([]*yaml.Node(nil), d.settings.Content...)}
+	root.Content = append(root.Content, scalarNode("profiles"), profiles)
+	return root
+}
+
+// profileHosts returns the merged hosts of a profile
+func (d *configDocument) profileHosts(name string) hostList {
+	if profile, exists := d.profiles[name]; exists {
+		return profile.hosts
+	}
+	return nil
+}
+
+// scalarNode creates a string scalar node
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// mappingValue returns the value of key in a mapping node, or an unset node if it is missing
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return &yaml.Node{}
+}
+
+// scalarValue returns the value of key in a mapping node if it is a scalar
+func scalarValue(node *yaml.Node, key string) string {
+	if value := mappingValue(node, key); value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// setMappingValue sets key in a mapping node, replacing any existing value
+func setMappingValue(node *yaml.Node, key, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key.Value {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, key, value)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain points the global drop-in directory at an empty one, so drop-ins in the real
+// ~/.config/portsmith/conf.d don't leak into the tests' configs
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "portsmith-conf.d")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	globalDropInDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// writeConfigFiles writes files, keyed by path relative to a temp directory, and returns
+// the path of config.yaml in it
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+func TestLoadConfigIncludes(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include: [team/*.yaml]
+log_level: warn
+defaults:
+  jump_host: bastion.example.com
+hosts:
+  - name: main
+    local_ip: 127.0.0.2
+    remote_host: 10.0.0.1
+    ports: [80]
+`,
+		"team/b.yaml": `hosts:
+  - name: db
+    local_ip: 127.0.0.3
+    remote_host: 10.0.0.3
+    ports: [5432]
+`,
+		"team/a.yaml": `defaults:
+  key_path: ~/.ssh/team
+hosts:
+  - name: api
+    local_ip: 127.0.0.4
+    remote_host: 10.0.0.4
+    ports: [443]
+`,
+		"conf.d/10-personal.yaml": `log_level: debug
+hosts:
+  - name: db
+    jump_host: personal.example.com
+`,
+		"conf.d/20-extra.yaml": `hosts:
+  - name: extra
+    local_ip: 127.0.0.5
+    remote_host: 10.0.0.5
+    ports: [80]
+`,
+		"conf.d/ignored.yml": "log_level: error\n",
+	})
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	var names []string
+	hosts := make(map[string]HostConfig)
+	for _, host := range config.Hosts {
+		names = append(names, host.Name)
+		hosts[host.Name] = host
+	}
+	// Main file, then includes sorted by name, then conf.d sorted by name
+	if fmt.Sprint(names) != "[main api db extra]" {
+		t.Errorf("hosts = %v", names)
+	}
+	if config.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want the later file's setting", config.LogLevel)
+	}
+
+	db := hosts["db"]
+	if db.JumpHost != "personal.example.com" || db.RemoteHost != "10.0.0.3" || db.KeyPath != "~/.ssh/team" {
+		t.Errorf("db = %+v, want the override merged over the team host and defaults", db)
+	}
+	if !strings.HasSuffix(db.Source, filepath.Join("conf.d", "10-personal.yaml")+":3") ||
+		!strings.Contains(db.Source, filepath.Join("team", "b.yaml")+":2, ") {
+		t.Errorf("db.Source = %q, want both files", db.Source)
+	}
+	if hosts["main"].JumpHost != "bastion.example.com" || hosts["main"].KeyPath != "~/.ssh/team" {
+		t.Errorf("main = %+v, want defaults merged from every file", hosts["main"])
+	}
+}
+
+func TestLoadConfigGlobalDropIns(t *testing.T) {
+	globalDir := t.TempDir()
+	defaultDir := globalDropInDir
+	globalDropInDir = globalDir
+	defer func() { globalDropInDir = defaultDir }()
+	if err := os.WriteFile(filepath.Join(globalDir, "personal.yaml"), []byte("hosts:\n  - {name: db, jump_host: personal.example.com}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any config also gets the global drop-ins, after its own
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": `defaults: {jump_host: bastion.example.com}
+hosts:
+  - {name: db, local_ip: 127.0.0.2, remote_host: 10.0.0.1, ports: [5432]}
+`,
+		"conf.d/team.yaml": "hosts:\n  - {name: db, jump_host: team.example.com, key_path: ~/.ssh/team}\n",
+	})
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if db := config.Hosts[0]; db.JumpHost != "personal.example.com" || db.KeyPath != "~/.ssh/team" {
+		t.Errorf("db = %+v, want the global drop-in merged over the local one", db)
+	}
+}
+
+func TestLoadConfigIncludeProfiles(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include: [local.yaml]
+profile: dev
+profiles:
+  dev:
+    defaults:
+      jump_host: dev.example.com
+    hosts:
+      - name: db
+        local_ip: 127.0.0.2
+        remote_host: 10.0.0.1
+`,
+		"local.yaml": `profiles:
+  dev:
+    hosts:
+      - name: db
+        remote_host: 10.9.0.1
+      - name: cache
+        local_ip: 127.0.0.3
+        remote_host: 10.0.0.2
+`,
+	})
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(config.Hosts) != 2 {
+		t.Fatalf("hosts = %+v, want db and cache", config.Hosts)
+	}
+	if db := config.Hosts[0]; db.RemoteHost != "10.9.0.1" || db.LocalIP != "127.0.0.2" || db.JumpHost != "dev.example.com" {
+		t.Errorf("db = %+v, want the local override merged over the profile host", db)
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr []string
+	}{
+		{
+			name: "port conflict names both files",
+			files: map[string]string{
+				"config.yaml":    "include: [team.yaml]\ndefaults: {jump_host: bastion.example.com}\n",
+				"team.yaml":      "hosts:\n  - {name: db, local_ip: 127.0.0.2, remote_host: 10.0.0.1, ports: [80]}\n",
+				"conf.d/me.yaml": "hosts:\n  - {name: api, local_ip: 127.0.0.2, remote_host: 10.0.0.2, ports: [80]}\n",
+			},
+			wantErr: []string{"port conflict", "db (", "team.yaml:2)", "api (", "me.yaml:2)"},
+		},
+		{
+			name: "duplicate name within a file",
+			files: map[string]string{
+				"config.yaml": "hosts:\n  - {name: db, remote_host: a.example.com}\n  - {name: db, remote_host: b.example.com}\n",
+			},
+			wantErr: []string{`duplicate host name "db"`, "config.yaml:2 and", "config.yaml:3"},
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"config.yaml": "include: [missing.yaml]\n",
+			},
+			wantErr: []string{"config.yaml", `include "missing.yaml"`},
+		},
+		{
+			name: "parse error names the file",
+			files: map[string]string{
+				"config.yaml":     "hosts: []\n",
+				"conf.d/bad.yaml": "hosts: [\n",
+			},
+			wantErr: []string{"failed to parse config", "bad.yaml"},
+		},
+		{
+			name: "invalid host names the file",
+			files: map[string]string{
+				"config.yaml": "include: [hosts.yaml]\n",
+				"hosts.yaml":  "hosts:\n  - local_ip: 127.0.0.2\n    jump_port: x\n",
+			},
+			wantErr: []string{"hosts.yaml:2: ", "line 3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfigFiles(t, tt.files))
+			if err == nil {
+				t.Fatal("LoadConfig() should fail")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigIncludeCycle(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": "include: [other.yaml]\ndefaults: {jump_host: bastion.example.com}\nhosts:\n  - {name: a, remote_host: a.example.com}\n",
+		"other.yaml":  "include: [config.yaml]\nhosts:\n  - {name: b, remote_host: b.example.com}\n",
+	})
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(config.Hosts) != 2 {
+		t.Errorf("hosts = %+v, want each file merged once", config.Hosts)
+	}
+}
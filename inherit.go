@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resolveHosts decodes host nodes after applying inherited settings. From lowest to highest
+// precedence, a host's settings come from the config's defaults, the profile's defaults,
+// the template chain named by extends, and finally the host itself. Environment variables
+// are then interpolated. Built-in defaults such as jump_port are applied afterwards by
+// LoadConfig to whatever is still unset. Hosts that fail to decode are left out and their
+// errors returned together.
+func (c *Config) resolveHosts(nodes hostList, profileDefaults *yaml.Node) ([]HostConfig, error) {
+	if err := requireMapping(&c.Defaults, "defaults"); err != nil {
+		return nil, err
+	}
+	if err := requireMapping(profileDefaults, "defaults"); err != nil {
+		return nil, err
+	}
+	base := mergeMappings(&c.Defaults, profileDefaults)
+
+	hosts := make([]HostConfig, 0, len(nodes))
+	var errs []error
+	for _, entry := range nodes {
+		host, err := c.resolveHost(entry.node, base)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.source(), err))
+			continue
+		}
+		host.Source = entry.source()
+		hosts = append(hosts, host)
+	}
+	return hosts, errors.Join(errs...)
+}
+
+// resolveHost decodes a single host node over the settings it inherits
+func (c *Config) resolveHost(node, base *yaml.Node) (HostConfig, error) {
+	var host HostConfig
+	if node.Kind != yaml.MappingNode {
+		return host, fmt.Errorf("host must be a mapping of host settings")
+	}
+
+	template, err := c.templateNode(extendsName(node), nil)
+	if err != nil {
+		return host, err
+	}
+
+	merged, err := interpolateHost(mergeMappings(mergeMappings(base, template), node))
+	if err != nil {
+		return host, err
+	}
+
+	err = merged.Decode(&host)
+	return host, err
+}
+
+// templateNode returns the named template merged over the templates it extends, or an
+// empty node if name is empty. seen holds the templates already on the chain, to detect cycles.
+func (c *Config) templateNode(name string, seen []string) (*yaml.Node, error) {
+	if name == "" {
+		return &yaml.Node{}, nil
+	}
+
+	for _, parent := range seen {
+		if parent == name {
+			return nil, fmt.Errorf("template %s extends itself: %s", name, strings.Join(append(seen, name), " -> "))
+		}
+	}
+
+	template, exists := c.Templates[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown template %q in extends", name)
+	}
+	if err := requireMapping(&template, "templates."+name); err != nil {
+		return nil, err
+	}
+
+	parent, err := c.templateNode(extendsName(&template), append(seen, name))
+	if err != nil {
+		return nil, err
+	}
+	return mergeMappings(parent, &template), nil
+}
+
+// extendsName returns the template a host or template node extends, if any
+func extendsName(node *yaml.Node) string {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "extends" {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// requireMapping checks that an optional settings block is a mapping; name prefixes errors
+func requireMapping(node *yaml.Node, name string) error {
+	if node.Kind != 0 && node.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid %s: must be a mapping of host settings", name)
+	}
+	return nil
+}
+
+// mergeMappings returns a mapping with the keys of override, plus those of base that
+// override doesn't set. Values are replaced whole rather than merged recursively, so a
+// host's limits replace the default limits entirely. An unset (zero) node leaves the
+// other one unchanged.
+func mergeMappings(base, override *yaml.Node) *yaml.Node {
+	if override.Kind == 0 {
+		return base
+	}
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+
+	set := make(map[string]bool, len(override.Content)/2)
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		set[override.Content[i].Value] = true
+	}
+
+	merged := *override
+	merged.Content = nil
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		if !set[base.Content[i].Value] {
+			merged.Content = append(merged.Content, base.Content[i], base.Content[i+1])
+		}
+	}
+	merged.Content = append(merged.Content, override.Content...)
+	return &merged
+}
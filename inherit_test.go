@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const inheritConfig = `defaults:
+  jump_host: bastion.example.com
+  jump_port: 2200
+  key_path: ~/.ssh/default
+  identity_agent: ~/agent.sock
+templates:
+  work:
+    key_path: ~/.ssh/work
+    jump_port: 2222
+  work-db:
+    extends: work
+    jump_host: db-bastion.example.com
+    access_log: true
+hosts:
+  - name: plain
+    local_ip: 127.0.0.2
+    remote_host: 10.0.0.1
+  - name: templated
+    extends: work-db
+    local_ip: 127.0.0.3
+    remote_host: 10.0.0.2
+  - name: overridden
+    extends: work-db
+    local_ip: 127.0.0.4
+    remote_host: 10.0.0.3
+    jump_port: 22
+    access_log: false
+profiles:
+  dev:
+    defaults:
+      jump_host: dev-bastion.example.com
+      key_path: ~/.ssh/dev
+    hosts:
+      - name: dev-plain
+        local_ip: 127.0.0.5
+        remote_host: 10.0.0.4
+      - name: dev-templated
+        extends: work
+        local_ip: 127.0.0.6
+        remote_host: 10.0.0.5
+`
+
+func TestLoadConfigInheritancePrecedence(t *testing.T) {
+	config, err := LoadConfigProfile(writeConfig(t, inheritConfig), "dev")
+	if err != nil {
+		t.Fatalf("LoadConfigProfile() error = %v", err)
+	}
+
+	tests := []struct {
+		host          string
+		jumpHost      string
+		jumpPort      int
+		keyPath       string
+		identityAgent string
+		accessLog     bool
+	}{
+		// Global defaults only
+		{"plain", "bastion.example.com", 2200, "~/.ssh/default", "~/agent.sock", false},
+		// Template chain over defaults: work-db's jump_host, work's key_path and port
+		{"templated", "db-bastion.example.com", 2222, "~/.ssh/work", "~/agent.sock", true},
+		// The host's own settings beat its template, including explicit false
+		{"overridden", "db-bastion.example.com", 22, "~/.ssh/work", "~/agent.sock", false},
+		// Profile defaults over global defaults
+		{"dev-plain", "dev-bastion.example.com", 2200, "~/.ssh/dev", "~/agent.sock", false},
+		// Templates over profile defaults
+		{"dev-templated", "dev-bastion.example.com", 2222, "~/.ssh/work", "~/agent.sock", false},
+	}
+
+	hosts := make(map[string]HostConfig)
+	for _, host := range config.Hosts {
+		hosts[host.Name] = host
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			host, exists := hosts[tt.host]
+			if !exists {
+				t.Fatalf("host %s not loaded", tt.host)
+			}
+			if host.JumpHost != tt.jumpHost || host.JumpPort != tt.jumpPort || host.KeyPath != tt.keyPath ||
+				host.IdentityAgent != tt.identityAgent || host.AccessLog != tt.accessLog {
+				t.Errorf("got jump_host=%s jump_port=%d key_path=%s identity_agent=%s access_log=%v, want %+v",
+					host.JumpHost, host.JumpPort, host.KeyPath, host.IdentityAgent, host.AccessLog, tt)
+			}
+		})
+	}
+}
+
+func TestLoadConfigBuiltinDefaultsAfterInheritance(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, `defaults:
+  identity_agent: ~/agent.sock
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: 10.0.0.1
+    jump_host: bastion.example.com
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	host := config.Hosts[0]
+	if host.JumpPort != SSHDefaultPort || host.KeyPath != DefaultKeyPath || host.IdentityAgent != "~/agent.sock" {
+		t.Errorf("host = %+v, want built-in defaults for settings nothing inherits", host)
+	}
+}
+
+func TestLoadConfigInheritanceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown template", "hosts:\n  - extends: nope\n", `unknown template "nope"`},
+		{"template cycle", "templates:\n  a: {extends: b}\n  b: {extends: a}\nhosts:\n  - extends: a\n", "a -> b -> a"},
+		{"defaults not a mapping", "defaults: [1]\nhosts: []\n", "invalid defaults"},
+		{"template not a mapping", "templates:\n  a: x\nhosts:\n  - extends: a\n", "invalid templates.a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMergeMappings(t *testing.T) {
+	var base, override yaml.Node
+	if err := yaml.Unmarshal([]byte("jump_host: a\nlimits: {rate: 1, burst: 2}\nenabled: true\n"), &base); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte("limits: {rate: 5}\nenabled: false\nlocal_ip: 127.0.0.2\n"), &override); err != nil {
+		t.Fatal(err)
+	}
+
+	var host HostConfig
+	if err := mergeMappings(base.Content[0], override.Content[0]).Decode(&host); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if host.JumpHost != "a" || host.LocalIP != "127.0.0.2" || host.isEnabled() {
+		t.Errorf("merged host = %+v", host)
+	}
+	if host.Limits.Rate != 5 || host.Limits.Burst != 0 {
+		t.Errorf("limits = %+v, want the host's limits to replace the defaults whole", host.Limits)
+	}
+
+	if merged := mergeMappings(base.Content[0], &yaml.Node{}); merged != base.Content[0] {
+		t.Error("merging an unset node should leave the base unchanged")
+	}
+}
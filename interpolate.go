@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpolate replaces ${VAR} with the value of an environment variable, and ${VAR:-default}
+// with its value or default when it's unset or empty. $$ produces a literal $. A $ that
+// doesn't start either form is kept as is, so shell-style $VAR passes through untouched.
+func interpolate(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			expr := s[i+2 : i+end]
+			name, fallback, hasDefault := strings.Cut(expr, ":-")
+			if !validEnvName(name) {
+				return "", fmt.Errorf("invalid variable ${%s} in %q", expr, s)
+			}
+
+			value, set := lookup(name)
+			switch {
+			case set && value != "":
+			case hasDefault:
+				value = fallback
+			case !set:
+				return "", fmt.Errorf("environment variable %s is not set (use ${%s:-default} to allow that)", name, name)
+			}
+			b.WriteString(value)
+			i += end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// validEnvName reports whether name is a valid environment variable name
+func validEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// interpolateHost returns a copy of a host node with environment variables interpolated
+// in every scalar, so ${VAR} works in any setting, including ports and jump_port. Hooks
+// and exec: secrets are left alone since their commands are run by the shell, which
+// expands them itself.
+func interpolateHost(node *yaml.Node) (*yaml.Node, error) {
+	return interpolateNode(node, os.LookupEnv)
+}
+
+// interpolateNode copies a node tree, interpolating its scalars. A plain scalar that changes
+// is re-resolved, so "jump_port: ${PORT}" decodes as an int.
+func interpolateNode(node *yaml.Node, lookup func(string) (string, bool)) (*yaml.Node, error) {
+	copied := *node
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		value, err := interpolate(node.Value, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		if value != node.Value {
+			copied.Value = value
+			if node.Style == 0 && node.Tag == "!!str" {
+				copied.Tag = ""
+			}
+		}
+
+	case yaml.MappingNode, yaml.SequenceNode:
+		copied.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			if node.Kind == yaml.MappingNode && i%2 == 1 && runByShell(node.Content[i-1].Value, child) {
+				copied.Content[i] = child
+				continue
+			}
+			interpolated, err := interpolateNode(child, lookup)
+			if err != nil {
+				return nil, err
+			}
+			copied.Content[i] = interpolated
+		}
+	}
+	return &copied, nil
+}
+
+// runByShell reports whether a setting's value holds shell commands: hooks, and passphrases
+// or passwords that reference an exec: secret
+func runByShell(key string, value *yaml.Node) bool {
+	switch key {
+	case "hooks":
+		return true
+	case "key_passphrase", "password":
+		return value.Kind == yaml.ScalarNode && strings.HasPrefix(value.Value, "exec:")
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"USER": "alice", "EMPTY": "", "PORT": "2222"}
+	lookup := func(name string) (string, bool) {
+		value, set := env[name]
+		return value, set
+	}
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{"bastion.example.com", "bastion.example.com", ""},
+		{"${USER}.bastion.example.com", "alice.bastion.example.com", ""},
+		{"${MISSING:-bastion}.example.com", "bastion.example.com", ""},
+		{"${EMPTY:-fallback}", "fallback", ""},
+		{"${USER:-fallback}", "alice", ""},
+		{"${MISSING:-}", "", ""},
+		{"${EMPTY}", "", ""},
+		{"a${USER}b${PORT}", "aaliceb2222", ""},
+		{"$$HOME and $HOME", "$HOME and $HOME", ""},
+		{"cost: 5$", "cost: 5$", ""},
+		{"${MISSING}", "", "MISSING is not set"},
+		{"${USER", "", "unterminated"},
+		{"${1BAD}", "", "invalid variable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := interpolate(tt.input, lookup)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("interpolate() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("interpolate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInterpolation(t *testing.T) {
+	t.Setenv("PORTSMITH_TEST_BASTION", "alice.bastion.example.com")
+	t.Setenv("PORTSMITH_TEST_JUMP_PORT", "2222")
+
+	config, err := LoadConfig(writeConfig(t, `defaults:
+  jump_host: ${PORTSMITH_TEST_BASTION}
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: ${PORTSMITH_TEST_REMOTE:-db.example.com}
+    jump_port: ${PORTSMITH_TEST_JUMP_PORT}
+    ports:
+      - ${PORTSMITH_TEST_DB_PORT:-5432}
+    password: exec:echo ${SECRET}
+    key_passphrase: file:${PORTSMITH_TEST_SECRETS:-/secrets}/key
+    hooks:
+      on_connect: echo ${PORTSMITH_HOST}
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	host := config.Hosts[0]
+	if host.JumpHost != "alice.bastion.example.com" || host.JumpPort != 2222 || host.RemoteHost != "db.example.com" {
+		t.Errorf("host = %+v, want variables interpolated", host)
+	}
+	if ports, err := ExpandPorts(host); err != nil || len(ports) != 1 || ports[0] != 5432 {
+		t.Errorf("ExpandPorts() = %v, %v; want [5432]", ports, err)
+	}
+	if host.Password != "exec:echo ${SECRET}" {
+		t.Errorf("Password = %q, want exec: secrets left for the shell", host.Password)
+	}
+	if host.KeyPassphrase != "file:/secrets/key" {
+		t.Errorf("KeyPassphrase = %q, want file: secrets interpolated", host.KeyPassphrase)
+	}
+	if host.Hooks.OnConnect != "echo ${PORTSMITH_HOST}" {
+		t.Errorf("OnConnect = %q, want hooks left for the shell", host.Hooks.OnConnect)
+	}
+
+	_, err = LoadConfig(writeConfig(t, "hosts:\n  - local_ip: 127.0.0.2\n    jump_host: ${PORTSMITH_TEST_UNSET}\n"))
+	if err == nil || !strings.Contains(err.Error(), "PORTSMITH_TEST_UNSET") || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("LoadConfig() error = %v, want the unset variable and its line", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// LimitReject closes connections over the limit immediately
+	LimitReject = "reject"
+	// LimitQueue holds connections over the limit open until capacity frees up or queue_timeout expires
+	LimitQueue = "queue"
+
+	// DefaultQueueTimeout is how long a queued connection waits when queue_timeout is unset
+	DefaultQueueTimeout = 10 * time.Second
+)
+
+// ErrLimitReached is returned when a connection exceeds a concurrency or rate limit
+var ErrLimitReached = errors.New("connection limit reached")
+
+// ConnectionLimits caps how many connections a forward or jump host accepts
+type ConnectionLimits struct {
+	MaxConnections int           `yaml:"max_connections"` // Concurrent connections (0 = unlimited)
+	Rate           float64       `yaml:"rate"`            // New connections per second (0 = unlimited)
+	Burst          int           `yaml:"burst"`           // New connections allowed at once before rate applies (default: rate rounded up)
+	OnLimit        string        `yaml:"on_limit"`        // reject (default) or queue
+	QueueTimeout   time.Duration `yaml:"queue_timeout"`   // How long queued connections wait (default: 10s)
+}
+
+// enabled reports whether any limit is configured
+func (l ConnectionLimits) enabled() bool {
+	return l.MaxConnections > 0 || l.Rate > 0
+}
+
+// validate checks the limits for invalid values; name prefixes error messages
+func (l ConnectionLimits) validate(name string) error {
+	if l.MaxConnections < 0 {
+		return fmt.Errorf("invalid %s.max_connections: must not be negative", name)
+	}
+	if l.Rate < 0 {
+		return fmt.Errorf("invalid %s.rate: must not be negative", name)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("invalid %s.burst: must not be negative", name)
+	}
+	if l.QueueTimeout < 0 {
+		return fmt.Errorf("invalid %s.queue_timeout: must not be negative", name)
+	}
+	switch l.OnLimit {
+	case "", LimitReject, LimitQueue:
+	default:
+		return fmt.Errorf("invalid %s.on_limit %q: must be %s or %s", name, l.OnLimit, LimitReject, LimitQueue)
+	}
+	return nil
+}
+
+// connLimiter enforces ConnectionLimits with a slot semaphore and a token bucket
+type connLimiter struct {
+	limits ConnectionLimits
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	burst  float64
+	last   time.Time
+}
+
+// newConnLimiter creates a limiter, or returns nil when no limits are configured
+func newConnLimiter(limits ConnectionLimits) *connLimiter {
+	if !limits.enabled() {
+		return nil
+	}
+
+	l := &connLimiter{limits: limits, last: time.Now()}
+	if limits.MaxConnections > 0 {
+		l.slots = make(chan struct{}, limits.MaxConnections)
+	}
+	if limits.Rate > 0 {
+		l.burst = float64(limits.Burst)
+		if l.burst == 0 {
+			l.burst = math.Max(1, math.Ceil(limits.Rate))
+		}
+		l.tokens = l.burst
+	}
+	return l
+}
+
+// acquire admits a new connection, waiting when on_limit is queue until ctx is done. The
+// returned release function must be called when the connection closes. A nil limiter admits everything.
+func (l *connLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	queue := l.limits.OnLimit == LimitQueue
+	timeout := l.limits.QueueTimeout
+	if timeout == 0 {
+		timeout = DefaultQueueTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	release := func() {}
+	if l.slots != nil {
+		if queue {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			select {
+			case l.slots <- struct{}{}:
+			case <-timer.C:
+				return nil, fmt.Errorf("%w: %d concurrent connections", ErrLimitReached, l.limits.MaxConnections)
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		} else {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				return nil, fmt.Errorf("%w: %d concurrent connections", ErrLimitReached, l.limits.MaxConnections)
+			}
+		}
+		var once sync.Once
+		release = func() {
+			once.Do(func() { <-l.slots })
+		}
+	}
+
+	if l.limits.Rate > 0 {
+		var maxWait time.Duration
+		if queue {
+			maxWait = time.Until(deadline)
+		}
+		wait, ok := l.reserve(time.Now(), maxWait)
+		if !ok {
+			release()
+			return nil, fmt.Errorf("%w: %g new connections per second", ErrLimitReached, l.limits.Rate)
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return release, nil
+}
+
+// reserve takes a token from the bucket, returning how long the caller must wait for it.
+// It fails without taking a token if the wait would exceed maxWait.
+func (l *connLimiter) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed.Seconds()*l.limits.Rate)
+		l.last = now
+	}
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+
+	// Tokens may go negative so queued callers are spaced out at the configured rate
+	wait := time.Duration((1 - l.tokens) / l.limits.Rate * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+	l.tokens--
+	return wait, true
+}
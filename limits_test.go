@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConnectionLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    ConnectionLimits
+		shouldErr bool
+	}{
+		{"empty", ConnectionLimits{}, false},
+		{"reject", ConnectionLimits{MaxConnections: 10, Rate: 5, OnLimit: LimitReject}, false},
+		{"queue", ConnectionLimits{MaxConnections: 10, OnLimit: LimitQueue, QueueTimeout: time.Second}, false},
+		{"negative max", ConnectionLimits{MaxConnections: -1}, true},
+		{"negative rate", ConnectionLimits{Rate: -1}, true},
+		{"negative burst", ConnectionLimits{Burst: -1}, true},
+		{"negative timeout", ConnectionLimits{QueueTimeout: -time.Second}, true},
+		{"unknown on_limit", ConnectionLimits{OnLimit: "drop"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.validate("limits")
+			if (err != nil) != tt.shouldErr {
+				t.Errorf("validate() error = %v, shouldErr %v", err, tt.shouldErr)
+			}
+		})
+	}
+}
+
+func TestConnLimiterMaxConnections(t *testing.T) {
+	limiter := newConnLimiter(ConnectionLimits{MaxConnections: 2})
+
+	release1, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() #1 unexpected error: %v", err)
+	}
+	if _, err := limiter.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() #2 unexpected error: %v", err)
+	}
+	if _, err := limiter.acquire(context.Background()); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("acquire() #3 error = %v, want ErrLimitReached", err)
+	}
+
+	// Releasing twice must only free one slot
+	release1()
+	release1()
+	if _, err := limiter.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() after release unexpected error: %v", err)
+	}
+	if _, err := limiter.acquire(context.Background()); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("acquire() error = %v, want ErrLimitReached", err)
+	}
+}
+
+func TestConnLimiterQueue(t *testing.T) {
+	limiter := newConnLimiter(ConnectionLimits{MaxConnections: 1, OnLimit: LimitQueue, QueueTimeout: time.Second})
+
+	release, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() unexpected error: %v", err)
+	}
+	time.AfterFunc(20*time.Millisecond, release)
+
+	start := time.Now()
+	if _, err := limiter.acquire(context.Background()); err != nil {
+		t.Fatalf("queued acquire() unexpected error: %v", err)
+	}
+	if waited := time.Since(start); waited < 10*time.Millisecond {
+		t.Errorf("queued acquire() returned after %v, expected it to wait for release", waited)
+	}
+
+	limiter = newConnLimiter(ConnectionLimits{MaxConnections: 1, OnLimit: LimitQueue, QueueTimeout: 10 * time.Millisecond})
+	limiter.acquire(context.Background())
+	if _, err := limiter.acquire(context.Background()); !errors.Is(err, ErrLimitReached) {
+		t.Errorf("acquire() after queue timeout error = %v, want ErrLimitReached", err)
+	}
+}
+
+func TestConnLimiterReserve(t *testing.T) {
+	limiter := newConnLimiter(ConnectionLimits{Rate: 2, Burst: 2})
+	now := limiter.last
+
+	for i := 0; i < 2; i++ {
+		if wait, ok := limiter.reserve(now, 0); !ok || wait != 0 {
+			t.Fatalf("reserve() #%d = %v, %v, want burst token", i+1, wait, ok)
+		}
+	}
+	if _, ok := limiter.reserve(now, 0); ok {
+		t.Fatal("reserve() should fail once the burst is used and waiting is not allowed")
+	}
+
+	// Queued callers are spaced out at the configured rate
+	if wait, ok := limiter.reserve(now, time.Second); !ok || wait != 500*time.Millisecond {
+		t.Errorf("reserve() = %v, %v, want 500ms wait", wait, ok)
+	}
+	if wait, ok := limiter.reserve(now, time.Second); !ok || wait != time.Second {
+		t.Errorf("reserve() = %v, %v, want 1s wait", wait, ok)
+	}
+	if _, ok := limiter.reserve(now, time.Second); ok {
+		t.Error("reserve() should fail when the wait exceeds maxWait")
+	}
+
+	// Tokens refill over time
+	if wait, ok := limiter.reserve(now.Add(2*time.Second), 0); !ok || wait != 0 {
+		t.Errorf("reserve() after refill = %v, %v, want immediate token", wait, ok)
+	}
+}
+
+func TestNewConnLimiterUnlimited(t *testing.T) {
+	limiter := newConnLimiter(ConnectionLimits{OnLimit: LimitQueue})
+	if limiter != nil {
+		t.Fatal("newConnLimiter() should return nil without limits")
+	}
+	release, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("nil limiter acquire() unexpected error: %v", err)
+	}
+	release()
+}
+
+func TestLoadConfigLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `jump_host_limits:
+  bastion.example.com:
+    max_connections: 50
+    on_limit: queue
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: db.example.com
+    jump_host: bastion.example.com
+    limits:
+      max_connections: 5
+      rate: 10
+      queue_timeout: 2s
+    ports: [5432]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	limits := config.Hosts[0].Limits
+	if limits.MaxConnections != 5 || limits.Rate != 10 || limits.QueueTimeout != 2*time.Second {
+		t.Errorf("host limits = %+v", limits)
+	}
+	if jump := config.JumpHostLimits["bastion.example.com"]; jump.MaxConnections != 50 || jump.OnLimit != LimitQueue {
+		t.Errorf("jump host limits = %+v", jump)
+	}
+
+	if err := os.WriteFile(path, []byte("hosts:\n  - local_ip: 127.0.0.2\n    limits:\n      on_limit: drop\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig() should reject an invalid on_limit")
+	}
+}
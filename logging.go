@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// logOutput is where log records are written, set up by setupSystrayLogging
+var logOutput io.Writer = os.Stderr
+
+// logDirectory returns the directory holding portsmith.log and access.log
+func logDirectory() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, "Library", "Logs", "Portsmith"), nil
+}
+
+// parseLogLevel converts a log_level setting into a slog level
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log_level %q: must be debug, info, warn or error", level)
+	}
+}
+
+// newLogHandler builds a handler for the given log_level and log_format settings
+func newLogHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:     lvl,
+		AddSource: lvl == slog.LevelDebug,
+	}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid log_format %q: must be json or text", format)
+	}
+}
+
+// configureLogging installs the default logger for the configured log_level and log_format,
+// and applies log_rotation if logs go to a rotating file
+func configureLogging(config *Config) error {
+	handler, err := newLogHandler(logOutput, config.LogLevel, config.LogFormat)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(slog.New(handler))
+	if logFile, ok := logOutput.(*RotatingFile); ok {
+		logFile.SetRotation(config.LogRotation)
+	}
+	return nil
+}
+
+// forwardLogger returns a logger carrying the attributes that identify a forward
+func forwardLogger(cfg ForwardConfig) *slog.Logger {
+	host := cfg.RemoteHost
+	if cfg.RemoteSocket != "" {
+		host = cfg.RemoteSocket
+	}
+	return slog.With("host", host, "port", cfg.Port, "jump_host", cfg.JumpHost)
+}
+
+// fatal logs an error and exits, replacing log.Fatalf
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
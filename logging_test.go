@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newLogHandler(&buf, "warn", "json")
+	if err != nil {
+		t.Fatalf("newLogHandler() error = %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("filtered out")
+	logger.Warn("Connection closed", "conn_id", 7, "host", "db.example.com")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "Connection closed" || record["host"] != "db.example.com" || record["conn_id"] != float64(7) {
+		t.Errorf("Unexpected record: %v", record)
+	}
+}
+
+func TestNewLogHandlerInvalid(t *testing.T) {
+	if _, err := newLogHandler(&bytes.Buffer{}, "verbose", "text"); err == nil {
+		t.Error("newLogHandler() expected error for invalid level")
+	}
+	if _, err := newLogHandler(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("newLogHandler() expected error for invalid format")
+	}
+}
+
+func TestReloadConfigAppliesLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger, defaultOutput := slog.Default(), logOutput
+	logOutput = &buf
+	defer func() { slog.SetDefault(defaultLogger); logOutput = defaultOutput }()
+
+	path := writeConfig(t, "log_level: warn\nlog_format: json\nhosts: []\n")
+	df := &DynamicForwarder{configPath: path, statePath: StatePath(path)}
+	if err := df.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+
+	slog.Info("filtered out")
+	slog.Warn("kept")
+	if got := strings.TrimSpace(buf.String()); strings.Contains(got, "filtered out") || !strings.HasPrefix(got, "{") {
+		t.Errorf("log output = %q, want only the warning as JSON", got)
+	}
+}
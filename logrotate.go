@@ -0,0 +1,299 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLogMaxSize    ByteSize = 50 * 1024 * 1024
+	DefaultLogMaxBackups          = 5
+	rotatedTimeFormat             = "20060102-150405.000"
+)
+
+// LogRotationConfig controls size/age based rotation of the portsmith log files
+type LogRotationConfig struct {
+	MaxSize    ByteSize      `yaml:"max_size"`    // Rotate once the file exceeds this size, e.g. "50MB" (default 50MB)
+	MaxAge     time.Duration `yaml:"max_age"`     // Rotate once the file has been written to for this long, e.g. "24h" (disabled by default)
+	MaxBackups *int          `yaml:"max_backups"` // Number of rotated segments to keep; 0 keeps none (default 5)
+	Compress   *bool         `yaml:"compress"`    // Gzip rotated segments (default true)
+}
+
+// withDefaults fills in unset rotation settings
+func (c LogRotationConfig) withDefaults() LogRotationConfig {
+	if c.MaxSize == 0 {
+		c.MaxSize = DefaultLogMaxSize
+	}
+	if c.MaxBackups == nil {
+		maxBackups := DefaultLogMaxBackups
+		c.MaxBackups = &maxBackups
+	}
+	if c.Compress == nil {
+		compress := true
+		c.Compress = &compress
+	}
+	return c
+}
+
+// validate checks rotation settings for impossible values
+func (c LogRotationConfig) validate() error {
+	if c.MaxSize < 0 {
+		return fmt.Errorf("invalid log_rotation.max_size: must not be negative")
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("invalid log_rotation.max_age: must not be negative")
+	}
+	if c.MaxBackups != nil && *c.MaxBackups < 0 {
+		return fmt.Errorf("invalid log_rotation.max_backups: must not be negative")
+	}
+	return nil
+}
+
+// RotatingFile is an io.Writer that appends to a log file and rotates it by size and age.
+// Rotated segments are renamed with a timestamp suffix, optionally gzipped, and pruned to
+// the configured retention count. It is safe for concurrent use.
+type RotatingFile struct {
+	path string
+
+	mu       sync.Mutex
+	config   LogRotationConfig
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	millMu sync.Mutex     // Serializes compression and pruning of rotated segments
+	millWG sync.WaitGroup // Tracks in-flight compression so Close can wait for it
+}
+
+// OpenRotatingFile opens (or creates) the log file at path for appending
+func OpenRotatingFile(path string, config LogRotationConfig) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		path:   path,
+		config: config.withDefaults(),
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// SetRotation replaces the rotation settings, e.g. after the config has been loaded
+func (rf *RotatingFile) SetRotation(config LogRotationConfig) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	rf.config = config.withDefaults()
+}
+
+// Write appends p to the log file, rotating first if it would exceed the limits
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.shouldRotate(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			// Keep logging to the current file rather than losing records
+			fmt.Fprintf(os.Stderr, "portsmith: log rotation failed: %v\n", err)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate forces the current file to be rotated
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.rotate()
+}
+
+// Close closes the current log file and waits for pending compression to finish
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	var err error
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.mu.Unlock()
+
+	rf.millWG.Wait()
+	return err
+}
+
+// shouldRotate reports whether writing n more bytes requires a rotation
+func (rf *RotatingFile) shouldRotate(n int64) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.config.MaxSize > 0 && rf.size+n > int64(rf.config.MaxSize) {
+		return true
+	}
+	return rf.config.MaxAge > 0 && time.Since(rf.openedAt) > rf.config.MaxAge
+}
+
+// open opens the log file for appending and records its current size
+func (rf *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+	rf.openedAt = time.Now()
+	return nil
+}
+
+// rotate renames the current file to a timestamped segment and reopens a fresh file.
+// Must be called with rf.mu held.
+func (rf *RotatingFile) rotate() error {
+	if rf.file != nil {
+		if err := rf.file.Close(); err != nil {
+			return fmt.Errorf("failed to close log file: %w", err)
+		}
+		rf.file = nil
+	}
+
+	backup := rf.backupName(time.Now())
+	if err := os.Rename(rf.path, backup); err != nil && !os.IsNotExist(err) {
+		// Reopen the original so writes can continue
+		if openErr := rf.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rename log file: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.millWG.Add(1)
+	go rf.mill(backup, *rf.config.Compress, *rf.config.MaxBackups)
+	return nil
+}
+
+// backupName returns an unused timestamped name for a rotated segment
+func (rf *RotatingFile) backupName(now time.Time) string {
+	for {
+		backup := rf.path + "." + now.Format(rotatedTimeFormat)
+		if !fileExists(backup) && !fileExists(backup+".gz") {
+			return backup
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// mill compresses a freshly rotated segment and prunes segments beyond the retention count
+func (rf *RotatingFile) mill(backup string, compress bool, maxBackups int) {
+	defer rf.millWG.Done()
+	rf.millMu.Lock()
+	defer rf.millMu.Unlock()
+
+	// A segment about to be pruned isn't worth compressing
+	if compress && maxBackups > 0 {
+		if err := gzipFile(backup); err != nil {
+			slog.Warn("Failed to compress rotated log", "path", backup, "error", err)
+		}
+	}
+
+	segments, err := rf.segments()
+	if err != nil {
+		slog.Warn("Failed to list rotated logs", "path", rf.path, "error", err)
+		return
+	}
+
+	for len(segments) > maxBackups {
+		if err := os.Remove(segments[0]); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove old log", "path", segments[0], "error", err)
+		}
+		segments = segments[1:]
+	}
+}
+
+// segments returns the rotated segments for this file, oldest first
+func (rf *RotatingFile) segments() ([]string, error) {
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]string, 0, len(matches))
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, rf.path+"."), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err == nil {
+			segments = append(segments, match)
+		}
+	}
+
+	// Timestamps sort lexically; strip .gz so compressed and pending segments interleave correctly
+	sort.Slice(segments, func(i, j int) bool {
+		return strings.TrimSuffix(segments[i], ".gz") < strings.TrimSuffix(segments[j], ".gz")
+	})
+	return segments, nil
+}
+
+// gzipFile compresses path to path.gz and removes the original
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
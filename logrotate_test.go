@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "portsmith.log")
+
+	compress, maxBackups := true, 2
+	rf, err := OpenRotatingFile(path, LogRotationConfig{
+		MaxSize:    100,
+		MaxBackups: &maxBackups,
+		Compress:   &compress,
+	})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 8; i++ {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// Close waits for background compression and pruning to finish
+	if err := rf.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	segments, err := rf.segments()
+	if err != nil {
+		t.Fatalf("segments() error = %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("Expected 2 retained segments, got %d: %v", len(segments), segments)
+	}
+	for _, segment := range segments {
+		if !strings.HasSuffix(segment, ".gz") {
+			t.Errorf("Segment %s was not compressed", segment)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size() > 100 {
+		t.Errorf("Active log size = %d, want <= 100", info.Size())
+	}
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	maxBackups := 0
+	rf, err := OpenRotatingFile(filepath.Join(t.TempDir(), "portsmith.log"), LogRotationConfig{MaxSize: 100, MaxBackups: &maxBackups})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 4; i++ {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	segments, err := rf.segments()
+	if err != nil {
+		t.Fatalf("segments() error = %v", err)
+	}
+	if len(segments) != 0 {
+		t.Errorf("Expected no retained segments with max_backups 0, got %v", segments)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  ByteSize
+		shouldErr bool
+	}{
+		{"1048576", 1048576, false},
+		{"10MB", 10 << 20, false},
+		{"512KiB", 512 << 10, false},
+		{"1.5k", 1536, false},
+		{"2 GB", 2 << 30, false},
+		{"fast", 0, true},
+		{"-1MB", 0, true},
+		{"9999999999GB", 0, true},
+		{"inf", 0, true},
+	}
+
+	for _, tt := range tests {
+		size, err := parseByteSize(tt.input)
+		if tt.shouldErr {
+			if err == nil {
+				t.Errorf("parseByteSize(%q) expected error, got none", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseByteSize(%q) unexpected error: %v", tt.input, err)
+		} else if size != tt.expected {
+			t.Errorf("parseByteSize(%q) = %d, want %d", tt.input, size, tt.expected)
+		}
+	}
+}
+
+func TestConfigureLoggingAppliesRotation(t *testing.T) {
+	rf, err := OpenRotatingFile(filepath.Join(t.TempDir(), "portsmith.log"), LogRotationConfig{})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+	defer rf.Close()
+
+	defaultLogger, defaultOutput := slog.Default(), logOutput
+	logOutput = rf
+	defer func() { slog.SetDefault(defaultLogger); logOutput = defaultOutput }()
+
+	maxBackups := 2
+	if err := configureLogging(&Config{LogRotation: LogRotationConfig{MaxSize: 1024, MaxBackups: &maxBackups}}); err != nil {
+		t.Fatalf("configureLogging() error = %v", err)
+	}
+	rf.mu.Lock()
+	config := rf.config
+	rf.mu.Unlock()
+	if config.MaxSize != 1024 || *config.MaxBackups != 2 {
+		t.Errorf("rotation = %+v, want max_size 1024 and max_backups 2", config)
+	}
+}
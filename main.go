@@ -1,68 +1,111 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
 
 func main() {
-	helperPath := "/usr/local/bin/portsmith-helper"
-	if _, err := os.Stat(helperPath); err != nil {
-		helperPath = "bin/portsmith-helper"
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
 	}
 
+	profile := flag.String("profile", "", "config profile to forward (default: the last one selected, else the config's profile)")
+	flag.Parse()
+
+	helperPath := findHelperPath()
+
 	// Setup logging to file before any log statements
 	setupSystrayLogging()
 
 	configPath, err := FindConfigPath()
 	if err != nil {
-		log.Fatalf("Failed to find config: %v", err)
+		fatal("Failed to find config", "error", err)
+	}
+
+	slog.Info("Loading configuration", "path", configPath)
+
+	state, err := LoadState(StatePath(configPath))
+	if err != nil {
+		fatal("Failed to load state", "error", err)
+	}
+
+	config, err := loadProfileConfig(configPath, *profile, state)
+	if err != nil {
+		fatal("Failed to load config", "error", err)
+	}
+	if config.Profile != "" {
+		slog.Info("Using profile", "profile", config.Profile)
+	}
+	// An SSH agent may still provide the keys, so these don't stop startup
+	for _, err := range CheckKeyPaths(config) {
+		slog.Warn("SSH key may be unusable", "error", err)
 	}
 
-	log.Printf("Loading configuration from: %s", configPath)
+	if err := configureLogging(config); err != nil {
+		fatal("Failed to configure logging", "error", err)
+	}
 
-	config, err := LoadConfig(configPath)
+	forwarder, err := NewDynamicForwarder(configPath, *profile, config.Hosts, helperPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to initialize forwarder", "error", err)
 	}
 
-	forwarder, err := NewDynamicForwarder(configPath, config.Hosts, helperPath)
+	logDir, err := logDirectory()
 	if err != nil {
-		log.Fatalf("Failed to initialize forwarder: %v", err)
+		fatal("Failed to get log directory", "error", err)
+	}
+	forwarder.SetAccessLog(NewAccessLog(filepath.Join(logDir, "access.log"), config.LogRotation))
+
+	if config.Metrics.Listen != "" {
+		if _, err := StartMetricsServer(config.Metrics.Listen, forwarder); err != nil {
+			slog.Error("Failed to start metrics server", "error", err)
+		}
 	}
 
 	runSystrayMode(forwarder)
 }
 
+// findHelperPath returns the installed helper binary, else the one built in the source tree
+func findHelperPath() string {
+	helperPath := "/usr/local/bin/portsmith-helper"
+	if _, err := os.Stat(helperPath); err != nil {
+		helperPath = "bin/portsmith-helper"
+	}
+	return helperPath
+}
+
 // runSystrayMode runs portsmith with system tray UI
 func runSystrayMode(forwarder *DynamicForwarder) {
 	fmt.Println("Portsmith starting in system tray...")
 	fmt.Println("Logs: ~/Library/Logs/Portsmith/portsmith.log")
-	log.Println("Starting Portsmith in systray mode...")
+	slog.Info("Starting Portsmith in systray mode")
 	app := NewSystrayApp(forwarder)
 	app.Run()
 }
 
-// setupSystrayLogging redirects logs to a file
+// setupSystrayLogging redirects logs to a rotating file, using the default level,
+// format and rotation settings until the config has been loaded
 func setupSystrayLogging() {
-	homeDir, err := os.UserHomeDir()
+	logDir, err := logDirectory()
 	if err != nil {
-		log.Fatalf("Failed to get home directory: %v", err)
+		fatal("Failed to get log directory", "error", err)
 	}
 
-	logDir := filepath.Join(homeDir, "Library", "Logs", "Portsmith")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
-		log.Fatalf("Failed to create log directory: %v", err)
+		fatal("Failed to create log directory", "error", err)
 	}
 
-	logFile := filepath.Join(logDir, "portsmith.log")
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	logFile, err := OpenRotatingFile(filepath.Join(logDir, "portsmith.log"), LogRotationConfig{})
 	if err != nil {
-		log.Fatalf("Failed to open log file: %v", err)
+		fatal("Failed to open log file", "error", err)
 	}
 
-	log.SetOutput(f)
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	logOutput = logFile
+	if err := configureLogging(&Config{}); err != nil {
+		fatal("Failed to configure logging", "error", err)
+	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricsServer serves forwarder metrics in the Prometheus text exposition format
+type MetricsServer struct {
+	forwarder *DynamicForwarder
+	server    *http.Server
+	listener  net.Listener
+}
+
+// StartMetricsServer begins serving /metrics on the given loopback address
+func StartMetricsServer(listenAddr string, forwarder *DynamicForwarder) (*MetricsServer, error) {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics on %s: %w", listenAddr, err)
+	}
+
+	ms := &MetricsServer{
+		forwarder: forwarder,
+		listener:  listener,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", ms.handleMetrics)
+	ms.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := ms.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server error", "error", err)
+		}
+	}()
+
+	slog.Info("Serving metrics", "url", fmt.Sprintf("http://%s/metrics", listener.Addr()))
+	return ms, nil
+}
+
+// Close stops the metrics server
+func (ms *MetricsServer) Close() error {
+	return ms.server.Close()
+}
+
+func (ms *MetricsServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	ms.forwarder.WriteMetrics(w)
+}
+
+// WriteMetrics writes all forwarder metrics in the Prometheus text exposition format
+func (df *DynamicForwarder) WriteMetrics(w io.Writer) {
+	snapshot := df.Stats()
+
+	running := 0
+	if df.IsRunning() {
+		running = 1
+	}
+	writeMetricHeader(w, "portsmith_forwarder_running", "gauge", "Whether port forwarding is started (1) or stopped (0).")
+	fmt.Fprintf(w, "portsmith_forwarder_running %d\n", running)
+
+	writeMetricHeader(w, "portsmith_forwarder_health", "gauge", "Forwarder health: 0 healthy, 1 degraded, 2 error.")
+	fmt.Fprintf(w, "portsmith_forwarder_health %d\n", df.Health())
+
+	writeMetricHeader(w, "portsmith_ssh_pool_size", "gauge", "Number of open SSH connections to jump hosts.")
+	fmt.Fprintf(w, "portsmith_ssh_pool_size %d\n", df.sshPool.Size())
+
+	forwardMetrics := []struct {
+		name, kind, help string
+		value            func(ForwardStats) int64
+	}{
+		{"portsmith_forward_active_connections", "gauge", "Currently open forwarded connections.",
+			func(f ForwardStats) int64 { return f.ActiveConnections }},
+		{"portsmith_forward_connections_total", "counter", "Forwarded connections accepted.",
+			func(f ForwardStats) int64 { return f.TotalConnections }},
+		{"portsmith_forward_received_bytes_total", "counter", "Bytes sent by local clients to the remote.",
+			func(f ForwardStats) int64 { return f.BytesIn }},
+		{"portsmith_forward_sent_bytes_total", "counter", "Bytes sent by the remote back to local clients.",
+			func(f ForwardStats) int64 { return f.BytesOut }},
+		{"portsmith_forward_dial_errors_total", "counter", "Connections that could not be forwarded through the jump host.",
+			func(f ForwardStats) int64 { return f.Failures }},
+		{"portsmith_forward_rejected_connections_total", "counter", "Connections refused before forwarding.",
+			func(f ForwardStats) int64 { return f.Rejected }},
+	}
+	for _, metric := range forwardMetrics {
+		writeMetricHeader(w, metric.name, metric.kind, metric.help)
+		for _, fwd := range snapshot.Forwards {
+			fmt.Fprintf(w, "%s%s %d\n", metric.name, forwardLabels(fwd), metric.value(fwd))
+		}
+	}
+
+	writeMetricHeader(w, "portsmith_forward_dial_latency_seconds", "gauge", "Average time to open a remote channel, including any SSH handshake.")
+	for _, fwd := range snapshot.Forwards {
+		fmt.Fprintf(w, "portsmith_forward_dial_latency_seconds%s %g\n", forwardLabels(fwd), fwd.AvgDialLatency.Seconds())
+	}
+
+	writeMetricHeader(w, "portsmith_ssh_handshakes_total", "counter", "Completed SSH handshakes per jump host.")
+	for _, jh := range snapshot.JumpHosts {
+		fmt.Fprintf(w, "portsmith_ssh_handshakes_total%s %d\n", formatLabels("jump_host", jh.Address), jh.Handshakes)
+	}
+
+	writeMetricHeader(w, "portsmith_ssh_reconnects_total", "counter", "Stale SSH connections replaced per jump host.")
+	for _, jh := range snapshot.JumpHosts {
+		fmt.Fprintf(w, "portsmith_ssh_reconnects_total%s %d\n", formatLabels("jump_host", jh.Address), jh.Reconnects)
+	}
+
+	writeMetricHeader(w, "portsmith_ssh_rejected_connections_total", "counter", "Connections refused by jump host limits.")
+	for _, jh := range snapshot.JumpHosts {
+		fmt.Fprintf(w, "portsmith_ssh_rejected_connections_total%s %d\n", formatLabels("jump_host", jh.Address), jh.Rejected)
+	}
+
+	timings := df.netSetup.HelperTimings()
+	commands := make([]string, 0, len(timings))
+	for command := range timings {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	writeMetricHeader(w, "portsmith_helper_invocation_duration_seconds", "summary", "Time spent running portsmith-helper commands.")
+	for _, command := range commands {
+		labels := formatLabels("command", command)
+		fmt.Fprintf(w, "portsmith_helper_invocation_duration_seconds_sum%s %g\n", labels, timings[command].Total.Seconds())
+		fmt.Fprintf(w, "portsmith_helper_invocation_duration_seconds_count%s %d\n", labels, timings[command].Count)
+	}
+}
+
+// writeMetricHeader writes the HELP and TYPE lines for a metric family
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// forwardLabels returns the label set identifying a forward
+func forwardLabels(fwd ForwardStats) string {
+	remoteHost := fwd.RemoteHost
+	if remoteHost == "" {
+		remoteHost = fwd.Remote // Socket forwards have no remote host
+	}
+	return formatLabels(
+		"local_ip", fwd.LocalIP,
+		"remote_host", remoteHost,
+		"port", strconv.Itoa(fwd.Port),
+		"jump_host", fwd.JumpHost,
+		"listen", fwd.Listen,
+	)
+}
+
+// formatLabels renders alternating name/value pairs as {name="value",...}
+func formatLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteString(`"`)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
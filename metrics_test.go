@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	df := &DynamicForwarder{
+		netSetup: &NetworkSetup{timings: make(map[string]HelperTiming)},
+		sshPool:  NewSSHClientPool(),
+		stats:    NewStats(),
+	}
+
+	counters := df.stats.forward(NewForwardConfig(HostConfig{
+		LocalIP:    "127.0.0.2",
+		RemoteHost: "db.example.com",
+		JumpHost:   "bastion.example.com",
+		JumpPort:   22,
+	}, 5432))
+	counters.connOpened()
+	counters.bytesIn.Add(42)
+	df.stats.recordHandshake("bastion.example.com:22")
+	df.netSetup.recordTiming("add-alias", 0)
+
+	var buf bytes.Buffer
+	df.WriteMetrics(&buf)
+	output := buf.String()
+
+	expected := []string{
+		"portsmith_forwarder_running 0",
+		`portsmith_forward_active_connections{local_ip="127.0.0.2",remote_host="db.example.com",port="5432",jump_host="bastion.example.com",listen="127.0.0.2:5432"} 1`,
+		`portsmith_forward_received_bytes_total{local_ip="127.0.0.2",remote_host="db.example.com",port="5432",jump_host="bastion.example.com",listen="127.0.0.2:5432"} 42`,
+		`portsmith_ssh_handshakes_total{jump_host="bastion.example.com:22"} 1`,
+		`portsmith_helper_invocation_duration_seconds_count{command="add-alias"} 1`,
+		"# TYPE portsmith_ssh_pool_size gauge",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("WriteMetrics() output missing %q", line)
+		}
+	}
+}
+
+func TestValidateMetricsConfig(t *testing.T) {
+	tests := []struct {
+		listen    string
+		shouldErr bool
+	}{
+		{"", false},
+		{"127.0.0.1:9477", false},
+		{"[::1]:9477", false},
+		{"localhost:9477", false},
+		{"0.0.0.0:9477", true},
+		{"192.168.1.10:9477", true},
+		{"9477", true},
+	}
+
+	for _, tt := range tests {
+		err := validateMetricsConfig(MetricsConfig{Listen: tt.listen})
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("validateMetricsConfig(%q) error = %v, shouldErr %v", tt.listen, err, tt.shouldErr)
+		}
+	}
+}
+
+func TestFormatLabelsEscaping(t *testing.T) {
+	got := formatLabels("path", "a\"b\\c\nd")
+	want := `{path="a\"b\\c\nd"}`
+	if got != want {
+		t.Errorf("formatLabels() = %s, want %s", got, want)
+	}
+}
@@ -2,14 +2,32 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
 )
 
+// hostsPath is the hosts file the helper adds entries to
+var hostsPath = "/etc/hosts"
+
+// pfAnchorPath is the pf anchor file the helper adds redirects to
+var pfAnchorPath = "/etc/pf.anchors/portsmith"
+
 // NetworkSetup handles privileged network operations via the helper binary
 type NetworkSetup struct {
 	helperPath string
+	timingsMu  sync.Mutex
+	timings    map[string]HelperTiming
+}
+
+// HelperTiming accumulates invocation counts and durations for a helper command
+type HelperTiming struct {
+	Count int64
+	Total time.Duration
 }
 
 // NewNetworkSetup creates a new network setup manager
@@ -20,6 +38,7 @@ func NewNetworkSetup(helperPath string) (*NetworkSetup, error) {
 
 	return &NetworkSetup{
 		helperPath: helperPath,
+		timings:    make(map[string]HelperTiming),
 	}, nil
 }
 
@@ -28,7 +47,34 @@ func (ns *NetworkSetup) runHelper(args ...string) error {
 	cmd := exec.Command("sudo", append([]string{ns.helperPath}, args...)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+
+	start := time.Now()
+	err := cmd.Run()
+	ns.recordTiming(args[0], time.Since(start))
+	return err
+}
+
+// recordTiming adds a helper invocation to the per-command timings
+func (ns *NetworkSetup) recordTiming(command string, elapsed time.Duration) {
+	ns.timingsMu.Lock()
+	defer ns.timingsMu.Unlock()
+
+	timing := ns.timings[command]
+	timing.Count++
+	timing.Total += elapsed
+	ns.timings[command] = timing
+}
+
+// HelperTimings returns a copy of the per-command helper invocation timings
+func (ns *NetworkSetup) HelperTimings() map[string]HelperTiming {
+	ns.timingsMu.Lock()
+	defer ns.timingsMu.Unlock()
+
+	timings := make(map[string]HelperTiming, len(ns.timings))
+	for command, timing := range ns.timings {
+		timings[command] = timing
+	}
+	return timings
 }
 
 // SetupLoopbackAlias creates a loopback alias for the given IP
@@ -37,13 +83,13 @@ func (ns *NetworkSetup) SetupLoopbackAlias(ip string) (func() error, error) {
 		return nil, fmt.Errorf("failed to add loopback alias %s: %w", ip, err)
 	}
 
-	log.Printf("Created loopback alias %s", ip)
+	slog.Info("Created loopback alias", "local_ip", ip)
 
 	cleanup := func() error {
 		if err := ns.runHelper("remove-alias", ip); err != nil {
 			return fmt.Errorf("failed to remove loopback alias %s: %w", ip, err)
 		}
-		log.Printf("Removed loopback alias %s", ip)
+		slog.Info("Removed loopback alias", "local_ip", ip)
 		return nil
 	}
 
@@ -60,35 +106,91 @@ func (ns *NetworkSetup) AddHostsEntries(ip string, hostnames []string) (func() e
 		if err := ns.runHelper("add-host", ip, hostname); err != nil {
 			return nil, fmt.Errorf("failed to add hosts entry %s -> %s: %w", hostname, ip, err)
 		}
-		log.Printf("Added /etc/hosts entry: %s -> %s", hostname, ip)
+		slog.Info("Added /etc/hosts entry", "hostname", hostname, "local_ip", ip)
 	}
 
 	cleanup := func() error {
 		for _, hostname := range hostnames {
 			if err := ns.runHelper("remove-host", ip, hostname); err != nil {
-				log.Printf("Failed to remove hosts entry %s -> %s: %v", hostname, ip, err)
+				slog.Warn("Failed to remove hosts entry", "hostname", hostname, "local_ip", ip, "error", err)
 			}
 		}
-		log.Printf("Removed /etc/hosts entries for %s", ip)
+		slog.Info("Removed /etc/hosts entries", "local_ip", ip)
 		return nil
 	}
 
 	return cleanup, nil
 }
 
+// loopbackAliasExists reports whether ip is already assigned to a network interface
+func loopbackAliasExists(ip string) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	want := net.ParseIP(ip)
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingHostsEntries returns the hostnames that don't already map to ip in the hosts file
+func missingHostsEntries(ip string, hostnames []string) []string {
+	content, err := os.ReadFile(hostsPath)
+	if err != nil {
+		return hostnames
+	}
+
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(content), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == ip {
+			for _, hostname := range fields[1:] {
+				existing[hostname] = true
+			}
+		}
+	}
+
+	var missing []string
+	for _, hostname := range hostnames {
+		if !existing[hostname] {
+			missing = append(missing, hostname)
+		}
+	}
+	return missing
+}
+
+// pfRedirectExists reports whether the pf anchor already redirects ip:fromPort to toPort
+func pfRedirectExists(ip string, fromPort, toPort int) bool {
+	content, err := os.ReadFile(pfAnchorPath)
+	if err != nil {
+		return false
+	}
+	rule := fmt.Sprintf("rdr pass on lo0 inet proto tcp from any to %s port %d -> %s port %d", ip, fromPort, ip, toPort)
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == rule {
+			return true
+		}
+	}
+	return false
+}
+
 // SetupPFRedirect creates a pf redirect for privileged ports
 func (ns *NetworkSetup) SetupPFRedirect(ip string, fromPort, toPort int) (func() error, error) {
 	if err := ns.runHelper("add-pf-redirect", ip, fmt.Sprintf("%d", fromPort), fmt.Sprintf("%d", toPort)); err != nil {
 		return nil, fmt.Errorf("failed to add pf redirect %s:%d -> %s:%d: %w", ip, fromPort, ip, toPort, err)
 	}
 
-	log.Printf("Created pf redirect: %s:%d -> %s:%d", ip, fromPort, ip, toPort)
+	slog.Info("Created pf redirect", "local_ip", ip, "port", fromPort, "listen_port", toPort)
 
 	cleanup := func() error {
 		if err := ns.runHelper("remove-pf-redirect", ip, fmt.Sprintf("%d", fromPort), fmt.Sprintf("%d", toPort)); err != nil {
 			return fmt.Errorf("failed to remove pf redirect %s:%d -> %s:%d: %w", ip, fromPort, ip, toPort, err)
 		}
-		log.Printf("Removed pf redirect: %s:%d -> %s:%d", ip, fromPort, ip, toPort)
+		slog.Info("Removed pf redirect", "local_ip", ip, "port", fromPort, "listen_port", toPort)
 		return nil
 	}
 
@@ -98,50 +200,16 @@ func (ns *NetworkSetup) SetupPFRedirect(ip string, fromPort, toPort int) (func()
 // Cleanup removes all portsmith resources (pf redirects, hosts entries, aliases)
 func (ns *NetworkSetup) Cleanup() error {
 	if err := ns.runHelper("remove-pf-redirects"); err != nil {
-		log.Printf("Failed to clean up pf redirects: %v", err)
+		slog.Warn("Failed to clean up pf redirects", "error", err)
 	}
 
 	if err := ns.runHelper("remove-hosts"); err != nil {
-		log.Printf("Failed to clean up hosts entries: %v", err)
+		slog.Warn("Failed to clean up hosts entries", "error", err)
 	}
 
 	if err := ns.runHelper("remove-aliases"); err != nil {
-		log.Printf("Failed to clean up loopback aliases: %v", err)
+		slog.Warn("Failed to clean up loopback aliases", "error", err)
 	}
 
 	return nil
 }
-
-// SetupNetwork configures all network settings for the given host configs
-func (ns *NetworkSetup) SetupNetwork(configs []HostConfig) ([]func() error, error) {
-	cleanups := make([]func() error, 0)
-
-	// Collect unique IPs to avoid duplicate alias creation
-	uniqueIPs := make(map[string]bool)
-	for _, cfg := range configs {
-		uniqueIPs[cfg.LocalIP] = true
-	}
-
-	// Create alias once per unique IP (skip 127.0.0.1 and ::1 as they already exist)
-	for ip := range uniqueIPs {
-		if ip == "127.0.0.1" || ip == "::1" {
-			continue
-		}
-		cleanup, err := ns.SetupLoopbackAlias(ip)
-		if err != nil {
-			return cleanups, fmt.Errorf("failed to setup loopback for %s: %w", ip, err)
-		}
-		cleanups = append(cleanups, cleanup)
-	}
-
-	// Add hosts entries for each config (can have multiple hostnames per IP)
-	for _, cfg := range configs {
-		cleanup, err := ns.AddHostsEntries(cfg.LocalIP, cfg.Hostnames)
-		if err != nil {
-			return cleanups, fmt.Errorf("failed to setup hosts entries for %s: %w", cfg.LocalIP, err)
-		}
-		cleanups = append(cleanups, cleanup)
-	}
-
-	return cleanups, nil
-}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// SOL_LOCAL and LOCAL_PEERPID from <sys/un.h>, which the syscall package doesn't define
+const (
+	solLocal     = 0
+	localPeerPID = 0x002
+)
+
+// unixPeerPID returns the PID of the process on the other end of a Unix socket connection
+// using LOCAL_PEERPID
+func unixPeerPID(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var pid int
+	var pidErr error
+	if err := raw.Control(func(fd uintptr) {
+		pid, pidErr = syscall.GetsockoptInt(int(fd), solLocal, localPeerPID)
+	}); err != nil {
+		return 0, err
+	}
+	if pidErr != nil {
+		return 0, pidErr
+	}
+	return pid, nil
+}
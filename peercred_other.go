@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// unixPeerPID is not supported on this platform
+func unixPeerPID(conn *net.UnixConn) (int, error) {
+	return 0, fmt.Errorf("process lookup is not supported on %s", runtime.GOOS)
+}
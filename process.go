@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// PeerProcess identifies the local process on the other end of a forwarded connection
+type PeerProcess struct {
+	PID  int
+	Name string // Executable name, e.g. "psql"
+	Path string // Full executable path when it can be resolved
+}
+
+// lookupPeerProcess resolves the local process that opened conn to one of our listeners
+func lookupPeerProcess(conn net.Conn) (PeerProcess, error) {
+	// Unix sockets report their peer directly
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		pid, err := unixPeerPID(unixConn)
+		if err != nil {
+			return PeerProcess{}, fmt.Errorf("failed to get socket peer: %w", err)
+		}
+		return lookupProcess(pid)
+	}
+
+	client, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return PeerProcess{}, fmt.Errorf("process lookup is only supported for TCP connections")
+	}
+	server, ok := conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return PeerProcess{}, fmt.Errorf("process lookup is only supported for TCP connections")
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return lookupPeerProcessLsof(client)
+	case "linux":
+		return lookupPeerProcessProc(client, server)
+	default:
+		return PeerProcess{}, fmt.Errorf("process lookup is not supported on %s", runtime.GOOS)
+	}
+}
+
+// lookupPeerProcessLsof finds the process owning the client end of a connection using lsof (macOS)
+func lookupPeerProcessLsof(client *net.TCPAddr) (PeerProcess, error) {
+	cmd := exec.Command("lsof", "-nP", "+c0", "-Fpcn", "-sTCP:ESTABLISHED",
+		fmt.Sprintf("-iTCP@%s", net.JoinHostPort(client.IP.String(), strconv.Itoa(client.Port))))
+	output, err := cmd.Output()
+	if err != nil {
+		return PeerProcess{}, fmt.Errorf("lsof failed: %w", err)
+	}
+
+	peer, err := parseLsofOutput(strings.NewReader(string(output)), client, os.Getpid())
+	if err != nil {
+		return PeerProcess{}, err
+	}
+
+	// lsof only reports the command name; ps gives the executable path
+	peer.Path = psExecutablePath(peer.PID)
+	return peer, nil
+}
+
+// psExecutablePath returns a process's executable path as ps reports it, or "" if it can't
+func psExecutablePath(pid int) string {
+	path, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(path))
+}
+
+// lookupProcess resolves the name and executable of a process by PID
+func lookupProcess(pid int) (PeerProcess, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		peer := PeerProcess{PID: pid, Path: psExecutablePath(pid)}
+		if peer.Path == "" {
+			return PeerProcess{}, fmt.Errorf("no process found with PID %d", pid)
+		}
+		peer.Name = filepath.Base(peer.Path)
+		return peer, nil
+	case "linux":
+		return procProcess(filepath.Join("/proc", strconv.Itoa(pid)))
+	default:
+		return PeerProcess{}, fmt.Errorf("process lookup is not supported on %s", runtime.GOOS)
+	}
+}
+
+// parseLsofOutput finds the process whose socket has client as its local address in
+// lsof -Fpcn output, ignoring our own end of the connection
+func parseLsofOutput(r io.Reader, client *net.TCPAddr, selfPID int) (PeerProcess, error) {
+	clientAddr := net.JoinHostPort(client.IP.String(), strconv.Itoa(client.Port))
+
+	var current PeerProcess
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case 'p':
+			pid, err := strconv.Atoi(line[1:])
+			if err != nil {
+				return PeerProcess{}, fmt.Errorf("unexpected lsof output %q", line)
+			}
+			current = PeerProcess{PID: pid}
+		case 'c':
+			current.Name = line[1:]
+		case 'n':
+			if current.PID != selfPID && strings.HasPrefix(line[1:], clientAddr+"->") {
+				return current, nil
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return PeerProcess{}, err
+	}
+	return PeerProcess{}, fmt.Errorf("no process found for %s", clientAddr)
+}
+
+// lookupPeerProcessProc finds the process owning the client end of a connection via /proc (Linux)
+func lookupPeerProcessProc(client, server *net.TCPAddr) (PeerProcess, error) {
+	var inode string
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(table)
+		if err != nil {
+			continue
+		}
+		inode, err = findSocketInode(f, client, server)
+		f.Close()
+		if err == nil && inode != "" {
+			break
+		}
+	}
+	if inode == "" {
+		return PeerProcess{}, fmt.Errorf("no socket found for %s", client)
+	}
+
+	target := "socket:[" + inode + "]"
+	procs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return PeerProcess{}, err
+	}
+
+	for _, proc := range procs {
+		fds, err := os.ReadDir(filepath.Join(proc, "fd"))
+		if err != nil {
+			continue // Process exited or belongs to another user
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(proc, "fd", fd.Name()))
+			if err != nil || link != target {
+				continue
+			}
+			return procProcess(proc)
+		}
+	}
+
+	return PeerProcess{}, fmt.Errorf("no process owns socket %s", inode)
+}
+
+// procProcess reads the name and executable of the process at a /proc/<pid> directory
+func procProcess(proc string) (PeerProcess, error) {
+	pid, err := strconv.Atoi(filepath.Base(proc))
+	if err != nil {
+		return PeerProcess{}, fmt.Errorf("invalid process directory %s", proc)
+	}
+
+	peer := PeerProcess{PID: pid}
+	comm, err := os.ReadFile(filepath.Join(proc, "comm"))
+	if err != nil {
+		return PeerProcess{}, fmt.Errorf("no process found with PID %d: %w", pid, err)
+	}
+	peer.Name = strings.TrimSpace(string(comm))
+	if exe, err := os.Readlink(filepath.Join(proc, "exe")); err == nil {
+		peer.Path = exe
+	}
+	return peer, nil
+}
+
+// findSocketInode returns the inode of the socket in a /proc/net/tcp table whose local
+// address is client and remote address is server
+func findSocketInode(r io.Reader, client, server *net.TCPAddr) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // Skip header
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		local, err := parseProcNetAddr(fields[1])
+		if err != nil || !tcpAddrEqual(local, client) {
+			continue
+		}
+		remote, err := parseProcNetAddr(fields[2])
+		if err != nil || !tcpAddrEqual(remote, server) {
+			continue
+		}
+		return fields[9], nil
+	}
+
+	return "", scanner.Err()
+}
+
+// parseProcNetAddr parses a hex "ADDR:PORT" pair from /proc/net/tcp{,6}. Addresses are
+// stored as host-endian 32-bit words, which is little-endian on every platform Go supports here.
+func parseProcNetAddr(s string) (*net.TCPAddr, error) {
+	hostHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+
+	raw, err := hex.DecodeString(hostHex)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", s)
+	}
+
+	return &net.TCPAddr{IP: net.IP(raw), Port: int(port)}, nil
+}
+
+// tcpAddrEqual compares addresses, treating IPv4 and IPv4-mapped IPv6 as equal
+func tcpAddrEqual(a, b *net.TCPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+// processAllowed reports whether peer matches an allowed_processes entry. Entries
+// containing a slash match the full executable path, others match the executable name.
+func processAllowed(peer PeerProcess, allowed []string) bool {
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if peer.Path != "" && peer.Path == entry {
+				return true
+			}
+			continue
+		}
+		if entry == peer.Name || (peer.Path != "" && entry == filepath.Base(peer.Path)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetAddr(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		shouldErr bool
+	}{
+		{"0100007F:1538", "127.0.0.1:5432", false},
+		{"0300007F:C7A2", "127.0.0.3:51106", false},
+		{"00000000000000000000000001000000:0050", "[::1]:80", false},
+		{"0000000000000000FFFF00000200007F:1F90", "127.0.0.2:8080", false},
+		{"0100007F", "", true},
+		{"01007F:0050", "", true},
+		{"ZZ00007F:0050", "", true},
+	}
+
+	for _, tt := range tests {
+		addr, err := parseProcNetAddr(tt.input)
+		if tt.shouldErr {
+			if err == nil {
+				t.Errorf("parseProcNetAddr(%q) expected error, got %v", tt.input, addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseProcNetAddr(%q) unexpected error: %v", tt.input, err)
+			continue
+		}
+		if !tcpAddrEqual(addr, mustResolveTCP(t, tt.expected)) {
+			t.Errorf("parseProcNetAddr(%q) = %v, want %s", tt.input, addr, tt.expected)
+		}
+	}
+}
+
+func TestFindSocketInode(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0300007F:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000   501        0 11111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:C7A2 0300007F:1538 01 00000000:00000000 00:00000000 00000000   501        0 22222 1 0000000000000000 20 4 30 10 -1
+   2: 0300007F:1538 0100007F:C7A2 01 00000000:00000000 00:00000000 00000000   501        0 33333 1 0000000000000000 20 4 30 10 -1
+`
+	client := mustResolveTCP(t, "127.0.0.1:51106")
+	server := mustResolveTCP(t, "127.0.0.3:5432")
+
+	inode, err := findSocketInode(strings.NewReader(table), client, server)
+	if err != nil {
+		t.Fatalf("findSocketInode() unexpected error: %v", err)
+	}
+	if inode != "22222" {
+		t.Errorf("findSocketInode() = %q, want client end 22222", inode)
+	}
+
+	inode, err = findSocketInode(strings.NewReader(table), mustResolveTCP(t, "127.0.0.1:1"), server)
+	if err != nil || inode != "" {
+		t.Errorf("findSocketInode() for unknown client = %q, %v, want no match", inode, err)
+	}
+}
+
+func TestParseLsofOutput(t *testing.T) {
+	output := "p100\ncportsmith\nn127.0.0.3:5432->127.0.0.1:51106\np200\ncpsql\nn127.0.0.1:51106->127.0.0.3:5432\n"
+	client := mustResolveTCP(t, "127.0.0.1:51106")
+
+	peer, err := parseLsofOutput(strings.NewReader(output), client, 100)
+	if err != nil {
+		t.Fatalf("parseLsofOutput() unexpected error: %v", err)
+	}
+	if peer.PID != 200 || peer.Name != "psql" {
+		t.Errorf("parseLsofOutput() = %+v, want pid 200 psql", peer)
+	}
+
+	if _, err := parseLsofOutput(strings.NewReader("p100\ncportsmith\n"), client, 100); err == nil {
+		t.Error("parseLsofOutput() expected error when only our own process is listed")
+	}
+}
+
+func TestProcessAllowed(t *testing.T) {
+	peer := PeerProcess{PID: 42, Name: "psql", Path: "/opt/homebrew/bin/psql"}
+
+	tests := []struct {
+		allowed  []string
+		expected bool
+	}{
+		{[]string{"psql"}, true},
+		{[]string{"curl", "psql"}, true},
+		{[]string{"/opt/homebrew/bin/psql"}, true},
+		{[]string{"/usr/bin/psql"}, false},
+		{[]string{"curl"}, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := processAllowed(peer, tt.allowed); got != tt.expected {
+			t.Errorf("processAllowed(%v) = %v, want %v", tt.allowed, got, tt.expected)
+		}
+	}
+
+	// Path entries never match when the executable path is unknown
+	if processAllowed(PeerProcess{Name: "psql"}, []string{"/opt/homebrew/bin/psql"}) {
+		t.Error("processAllowed() matched a path entry without a resolved path")
+	}
+}
+
+func mustResolveTCP(t *testing.T, addr string) *net.TCPAddr {
+	t.Helper()
+	resolved, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		t.Fatalf("ResolveTCPAddr(%q): %v", addr, err)
+	}
+	return resolved
+}
+
+func TestLookupPeerProcessUnix(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skipf("process lookup is not supported on %s", runtime.GOOS)
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "peer.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	peer, err := lookupPeerProcess(conn)
+	if err != nil {
+		t.Fatalf("lookupPeerProcess() error = %v", err)
+	}
+	if peer.PID != os.Getpid() || peer.Name == "" {
+		t.Errorf("peer = %+v, want this process (PID %d)", peer, os.Getpid())
+	}
+}
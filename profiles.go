@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownProfile is returned when selecting a profile the config doesn't define
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// ProfileConfig is a named set of hosts with settings shared by all of them. The hosts
+// themselves are resolved from the config files when the profile is applied.
+type ProfileConfig struct {
+	// Defaults holds host settings (jump_host, key_path, limits, ...) applied to every
+	// host in the profile that doesn't set them itself, taking precedence over the
+	// config's global defaults
+	Defaults yaml.Node `yaml:"defaults"`
+}
+
+// ProfileNames returns the names of the config's profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile adds the hosts of the named profile, or of the config's default profile if
+// name is empty, to the shared hosts and records it as the active profile
+func (c *Config) applyProfile(name string, doc *configDocument) error {
+	if name == "" {
+		name = c.Profile
+	}
+	c.Profile = name
+	if name == "" {
+		return nil
+	}
+
+	profile, exists := c.Profiles[name]
+	if !exists {
+		available := "none defined"
+		if len(c.Profiles) > 0 {
+			available = "available: " + strings.Join(c.ProfileNames(), ", ")
+		}
+		return fmt.Errorf("%w %q (%s)", ErrUnknownProfile, name, available)
+	}
+
+	hosts, err := c.resolveHosts(doc.profileHosts(name), &profile.Defaults)
+	c.Hosts = append(c.Hosts, hosts...)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	return nil
+}
+
+// loadProfileConfig loads the config with the profile to use: the requested one (from the
+// command line or the tray), else the one last selected at runtime, else the config's
+// default. A saved profile that has since been removed from the config is ignored.
+func loadProfileConfig(path, requested string, state *State) (*Config, error) {
+	if requested != "" || state == nil || state.Profile == "" {
+		return LoadConfigProfile(path, requested)
+	}
+
+	config, err := LoadConfigProfile(path, state.Profile)
+	if !errors.Is(err, ErrUnknownProfile) {
+		return config, err
+	}
+	slog.Warn("Saved profile no longer exists, using the default", "profile", state.Profile)
+	return LoadConfigProfile(path, "")
+}
+
+// Profiles returns the names of the config's profiles and the one in use, which is empty
+// when the config has no default and none was selected
+func (df *DynamicForwarder) Profiles() (names []string, active string) {
+	df.hostsMu.Lock()
+	defer df.hostsMu.Unlock()
+
+	return append([]string(nil), df.profiles...), df.active
+}
+
+// SetProfile switches to another profile, or to the config's default profile if name is
+// empty. If the forwarder is running, hosts that aren't in the new profile are drained and
+// torn down and its new hosts are brought up; hosts shared by both keep forwarding. The
+// choice is saved to the state file and used on restart unless --profile is given.
+func (df *DynamicForwarder) SetProfile(name string) error {
+	df.lifecycleMu.Lock()
+	defer df.lifecycleMu.Unlock()
+
+	if err := df.loadState(); err != nil {
+		return err
+	}
+
+	config, err := LoadConfigProfile(df.configPath, name)
+	if err != nil {
+		return err
+	}
+
+	df.profile = name
+	df.hostsMu.Lock()
+	df.state.Profile = name
+	df.hostsMu.Unlock()
+	if err := df.state.Save(df.statePath); err != nil {
+		return err
+	}
+
+	df.applyHosts(config)
+	df.events.Publish(Event{Type: EventConfigReloaded, Message: df.configPath})
+	slog.Info("Switched profile", "profile", config.Profile)
+
+	if !df.IsRunning() {
+		return nil
+	}
+	if err := df.reconcileHosts(); err != nil {
+		return fmt.Errorf("failed to switch to profile %s: %w", config.Profile, err)
+	}
+	return nil
+}
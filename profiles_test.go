@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const profilesConfig = `profile: staging
+hosts:
+  - name: shared
+    local_ip: 127.0.0.2
+    remote_host: 10.0.0.1
+    jump_host: bastion.example.com
+    ports: [8080]
+profiles:
+  staging:
+    defaults:
+      jump_host: bastion.staging.example.com
+      key_path: ~/.ssh/staging
+      access_log: true
+    hosts:
+      - name: db
+        local_ip: 127.0.0.3
+        remote_host: 10.1.0.5
+        ports: [5432]
+      - name: api
+        local_ip: 127.0.0.4
+        remote_host: 10.1.0.6
+        access_log: false
+        jump_host: other.example.com
+        ports: [443]
+  prod:
+    hosts:
+      - name: db
+        local_ip: 127.0.0.3
+        remote_host: 10.2.0.5
+        jump_host: bastion.prod.example.com
+        ports: [5432]
+`
+
+// writeConfig writes a config file to a temp directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigProfile(t *testing.T) {
+	path := writeConfig(t, profilesConfig)
+
+	tests := []struct {
+		name        string
+		profile     string
+		wantProfile string
+		wantHosts   []string
+		shouldErr   bool
+	}{
+		{"default profile", "", "staging", []string{"shared", "db", "api"}, false},
+		{"selected profile", "prod", "prod", []string{"shared", "db"}, false},
+		{"unknown profile", "dev", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadConfigProfile(path, tt.profile)
+			if (err != nil) != tt.shouldErr {
+				t.Fatalf("LoadConfigProfile() error = %v, shouldErr %v", err, tt.shouldErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrUnknownProfile) {
+					t.Errorf("error = %v, want ErrUnknownProfile", err)
+				}
+				return
+			}
+			if config.Profile != tt.wantProfile {
+				t.Errorf("Profile = %q, want %q", config.Profile, tt.wantProfile)
+			}
+			var names []string
+			for _, host := range config.Hosts {
+				names = append(names, host.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.wantHosts) {
+				t.Errorf("hosts = %v, want %v", names, tt.wantHosts)
+			}
+		})
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	db, api := config.Hosts[1], config.Hosts[2]
+	if db.JumpHost != "bastion.staging.example.com" || db.KeyPath != "~/.ssh/staging" || !db.AccessLog {
+		t.Errorf("db = %+v, want the profile defaults", db)
+	}
+	if api.JumpHost != "other.example.com" || api.AccessLog || api.KeyPath != "~/.ssh/staging" {
+		t.Errorf("api = %+v, want its own settings to override the defaults", api)
+	}
+	if names := config.ProfileNames(); fmt.Sprint(names) != "[prod staging]" {
+		t.Errorf("ProfileNames() = %v", names)
+	}
+}
+
+func TestLoadConfigProfileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"defaults not a mapping", "profiles:\n  dev:\n    defaults: [1]\n"},
+		{"no profiles", "profile: dev\nhosts: []\n"},
+		{"invalid profile host", "profiles:\n  dev:\n    hosts:\n      - ports: {a: b}\n        jump_port: x\nprofile: dev\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadConfigProfile(writeConfig(t, tt.content), "dev"); err == nil {
+				t.Error("LoadConfigProfile() should fail")
+			}
+		})
+	}
+}
+
+func TestLoadProfileConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, profilesConfig)
+
+	tests := []struct {
+		name      string
+		requested string
+		saved     string
+		want      string
+	}{
+		{"config default", "", "", "staging"},
+		{"saved at runtime", "", "prod", "prod"},
+		{"requested beats saved", "staging", "prod", "staging"},
+		{"removed saved profile is ignored", "", "dev", "staging"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := loadProfileConfig(path, tt.requested, &State{Profile: tt.saved})
+			if err != nil {
+				t.Fatalf("loadProfileConfig() error = %v", err)
+			}
+			if config.Profile != tt.want {
+				t.Errorf("Profile = %q, want %q", config.Profile, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetProfile(t *testing.T) {
+	sharedPort, stagingPort, prodPort := freePort(t), freePort(t), freePort(t)
+	// 127.0.0.1 without hostnames needs no helper calls; blackholed connections stay open
+	host := func(name string, port int) string {
+		return fmt.Sprintf(`
+      - name: %s
+        local_ip: 127.0.0.1
+        remote_host: 10.0.0.1
+        jump_host: bastion.invalid
+        hostnames: []
+        faults: {enabled: true, blackhole: true}
+        ports: [%d]`, name, port)
+	}
+	content := `profile: staging
+hosts:` + host("shared", sharedPort) + `
+profiles:
+  staging:
+    hosts:` + host("staging-db", stagingPort) + `
+  prod:
+    hosts:` + host("prod-db", prodPort) + "\n"
+	path := writeConfig(t, content)
+
+	df := &DynamicForwarder{
+		configPath:   path,
+		statePath:    StatePath(path),
+		netSetup:     &NetworkSetup{},
+		sshPool:      NewSSHClientPool(),
+		stats:        NewStats(),
+		drainTimeout: 50 * time.Millisecond,
+	}
+	if err := df.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	df.setRunning(true)
+	defer df.Close()
+	if err := df.reconcileHosts(); err != nil {
+		t.Fatalf("reconcileHosts() error = %v", err)
+	}
+
+	addr := func(port int) string { return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) }
+	waitForListening(t, addr(sharedPort), true)
+	waitForListening(t, addr(stagingPort), true)
+
+	// A connection to a host in both profiles survives the switch
+	client, err := net.Dial("tcp", addr(sharedPort))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := df.SetProfile("prod"); err != nil {
+		t.Fatalf("SetProfile() error = %v", err)
+	}
+	waitForListening(t, addr(stagingPort), false)
+	waitForListening(t, addr(prodPort), true)
+
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() error = %v, want the shared host's connection to stay open", err)
+	}
+
+	names, active := df.Profiles()
+	if fmt.Sprint(names) != "[prod staging]" || active != "prod" {
+		t.Errorf("Profiles() = %v, %q", names, active)
+	}
+	if state, err := LoadState(df.statePath); err != nil || state.Profile != "prod" {
+		t.Errorf("saved state = %+v, %v; want profile prod", state, err)
+	}
+
+	if err := df.SetProfile("dev"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("SetProfile(dev) error = %v, want ErrUnknownProfile", err)
+	}
+}
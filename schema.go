@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// schemaDraft is the JSON Schema version ConfigSchema follows
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	byteSizeType = reflect.TypeOf(ByteSize(0))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// schemaOverrides replaces the schema derived from a field's Go type where the type alone
+// doesn't say which values are accepted, keyed by struct name and YAML key
+var schemaOverrides = map[string]map[string]any{
+	"Config.log_level":          {"enum": []any{"debug", "info", "warn", "error"}},
+	"Config.log_format":         {"enum": []any{"text", "json"}},
+	"ConnectionLimits.on_limit": {"enum": []any{LimitReject, LimitQueue}},
+	"HostConfig.ports":          {"type": "array", "items": map[string]any{"$ref": "#/$defs/port"}},
+}
+
+// ConfigSchema returns a JSON Schema for config files, generated from the Config and
+// HostConfig types so it stays in step with what LoadConfig accepts
+func ConfigSchema() map[string]any {
+	schema := typeSchema(configType, false)
+	schema["$schema"] = schemaDraft
+	schema["title"] = "Portsmith config"
+	schema["$defs"] = map[string]any{
+		"host": typeSchema(hostType, true),
+		"port": map[string]any{
+			"description": "A port, a \"start-end\" range, or a port exposed on a local Unix socket",
+			"anyOf": []any{
+				map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+				map[string]any{"type": "string", "pattern": `^[0-9]+-[0-9]+$`},
+				map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"port":          map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+						"listen_socket": map[string]any{"type": "string"},
+						"socket_mode":   map[string]any{"type": []any{"string", "integer"}},
+					},
+					"required":             []any{"port"},
+					"additionalProperties": false,
+				},
+				map[string]any{"$ref": "#/$defs/variable"},
+			},
+		},
+		"variable": map[string]any{
+			"description": "A value containing ${VAR} or ${VAR:-default}, interpolated when the config is loaded",
+			"type":        "string",
+			"pattern":     `\$\{[A-Za-z_][A-Za-z0-9_]*(:-[^}]*)?\}`,
+		},
+	}
+	return schema
+}
+
+// typeSchema derives the schema for a Go type. Host settings are referenced rather than
+// repeated. In host settings, where environment variables are interpolated, values that
+// aren't plain strings may also be a ${VAR} reference.
+func typeSchema(t reflect.Type, interpolated bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == hostType && !interpolated, t == nodeType:
+		return map[string]any{"$ref": "#/$defs/host"}
+	case t == byteSizeType:
+		return allowVariable(map[string]any{
+			"description": `A number of bytes, or a size like "10MB" or "512KiB"`,
+			"anyOf": []any{
+				map[string]any{"type": "integer", "minimum": 0},
+				map[string]any{"type": "string", "pattern": `^\s*[0-9.]+\s*([KkMmGg]([Ii]?[Bb])?|[Bb])?\s*$`},
+			},
+		}, interpolated)
+	case t == durationType:
+		return allowVariable(map[string]any{
+			"description": `A duration like "500ms", "10s" or "1h30m"`,
+			"type":        "string",
+			"pattern":     `^-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+		}, interpolated)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return allowVariable(map[string]any{"type": "boolean"}, interpolated)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return allowVariable(map[string]any{"type": "integer"}, interpolated)
+	case reflect.Float32, reflect.Float64:
+		return allowVariable(map[string]any{"type": "number"}, interpolated)
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), interpolated)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), interpolated)}
+	case reflect.Struct:
+		return structSchema(t, interpolated)
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema describes a struct's YAML keys; any other key is rejected, as LoadConfig does
+func structSchema(t reflect.Type, interpolated bool) map[string]any {
+	fields := yamlFields(t)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties := make(map[string]any, len(fields))
+	for _, name := range names {
+		if override, exists := schemaOverrides[t.Name()+"."+name]; exists {
+			if _, isEnum := override["enum"]; isEnum {
+				override = allowVariable(override, interpolated)
+			}
+			properties[name] = override
+			continue
+		}
+		properties[name] = typeSchema(fields[name], interpolated)
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// allowVariable lets a host setting be a ${VAR} reference instead of a value of its type
+func allowVariable(schema map[string]any, interpolated bool) map[string]any {
+	if !interpolated {
+		return schema
+	}
+	variable := map[string]any{"$ref": "#/$defs/variable"}
+	if alternatives, isAnyOf := schema["anyOf"].([]any); isAnyOf {
+		schema["anyOf"] = append(alternatives, variable)
+		return schema
+	}
+	return map[string]any{"anyOf": []any{schema, variable}}
+}
+
+// runSchema prints the config file's JSON Schema
+func runSchema(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: portsmith schema > portsmith.schema.json")
+		return 2
+	}
+
+	data, err := json.MarshalIndent(ConfigSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
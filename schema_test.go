@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// runSchemaOutput runs the schema command and decodes the JSON it prints
+func runSchemaOutput(t *testing.T) map[string]any {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read while the command writes, so a large schema can't fill the pipe
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- data
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	code := runSchema(nil)
+	os.Stdout = stdout
+	writer.Close()
+
+	data := <-output
+	if code != 0 {
+		t.Fatalf("runSchema() = %d, want 0", code)
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema output isn't valid JSON: %v", err)
+	}
+	return schema
+}
+
+// yamlTags returns the YAML keys of a struct's fields
+func yamlTags(t reflect.Type) []string {
+	var tags []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name != "-" && field.IsExported() {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+// checkProperties compares a struct's YAML keys, plus extra, with the properties of its
+// schema, then does the same for each nested struct
+func checkProperties(t *testing.T, typ reflect.Type, schema map[string]any, path string, extra ...string) {
+	t.Helper()
+	properties, _ := schema["properties"].(map[string]any)
+	var keys []string
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	tags := append(yamlTags(typ), extra...)
+	sort.Strings(keys)
+	sort.Strings(tags)
+	if !slices.Equal(keys, tags) {
+		t.Errorf("%s: schema properties = %v, want the YAML keys %v", path, keys, tags)
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		property, _ := properties[name].(map[string]any)
+		if fieldType.Kind() != reflect.Struct || fieldType == hostType || fieldType == nodeType || property == nil {
+			continue
+		}
+		checkProperties(t, fieldType, property, path+"."+name)
+	}
+}
+
+func TestSchemaMatchesConfigTypes(t *testing.T) {
+	schema := runSchemaOutput(t)
+
+	// include is read from the YAML directly rather than through a field
+	checkProperties(t, configType, schema, "config", "include")
+
+	defs, _ := schema["$defs"].(map[string]any)
+	host, _ := defs["host"].(map[string]any)
+	if host == nil {
+		t.Fatal("schema has no host definition")
+	}
+	checkProperties(t, hostType, host, "host")
+}
+
+func TestSchemaOutput(t *testing.T) {
+	schema := runSchemaOutput(t)
+	if schema["$schema"] != schemaDraft {
+		t.Errorf("$schema = %v, want %s", schema["$schema"], schemaDraft)
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	logLevel, _ := properties["log_level"].(map[string]any)
+	if enum, _ := logLevel["enum"].([]any); len(enum) != 4 {
+		t.Errorf("log_level = %v, want an enum of the four levels", logLevel)
+	}
+	drainTimeout, _ := properties["drain_timeout"].(map[string]any)
+	pattern, _ := drainTimeout["pattern"].(string)
+	durations := regexp.MustCompile(pattern)
+	if pattern == "" || !durations.MatchString("1m30s") || durations.MatchString("soon") {
+		t.Errorf("drain_timeout pattern = %q, want one matching durations only", pattern)
+	}
+}
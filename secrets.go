@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultSecretTimeout bounds exec: secret commands, which may wait for the user to unlock
+// a password manager
+const DefaultSecretTimeout = 60 * time.Second
+
+// secretSchemes resolves secret references by scheme: "exec:op read op://vault/db/password"
+// runs a command, "file:~/.secrets/db" reads a file and "env:DB_PASSWORD" reads an
+// environment variable when the secret is needed. Add a scheme here to support another
+// secret store.
+var secretSchemes = map[string]func(ref string) (string, error){
+	"exec": execSecret,
+	"file": fileSecret,
+	"env":  envSecret,
+}
+
+// resolveSecret returns the value of a passphrase or password setting. Values starting
+// with a known scheme and a colon are references resolved through that scheme; anything
+// else is used literally.
+func resolveSecret(value string) (string, error) {
+	scheme, ref, found := strings.Cut(value, ":")
+	resolve, known := secretSchemes[scheme]
+	if !found || !known {
+		return value, nil
+	}
+
+	secret, err := resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s secret: %w", scheme, err)
+	}
+	return secret, nil
+}
+
+// execSecret runs a shell command and returns its output without the trailing newline
+func execSecret(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSecretTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// fileSecret reads a file and returns its contents without the trailing newline
+func fileSecret(path string) (string, error) {
+	expanded, err := ExpandKeyPath(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(expanded)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// envSecret reads an environment variable, which must be set
+func envSecret(name string) (string, error) {
+	value, set := os.LookupEnv(name)
+	if !set {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
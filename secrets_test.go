@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PORTSMITH_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"literal", "hunter2", "hunter2", ""},
+		{"unknown scheme is literal", "https://example.com", "https://example.com", ""},
+		{"exec", "exec:printf 'from-exec\\n'", "from-exec", ""},
+		{"file", "file:" + path, "from-file", ""},
+		{"env", "env:PORTSMITH_TEST_SECRET", "from-env", ""},
+		{"exec failure", "exec:echo nope >&2; exit 1", "", "nope"},
+		{"missing file", "file:" + path + ".missing", "", "failed to resolve file secret"},
+		{"unset env", "env:PORTSMITH_TEST_UNSET", "", "not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSecret(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveSecret() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveSecret() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// errSocketInUse means a socket file has a live listener behind it, perhaps another portsmith
+var errSocketInUse = errors.New("socket is already in use")
+
+// runtimeDir returns the per-user directory that holds relative listen sockets
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "portsmith")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("portsmith-%d", os.Getuid()))
+}
+
+// resolveSocketPath expands ~ and places relative socket paths under the runtime dir
+func resolveSocketPath(path string) (string, error) {
+	expanded, err := ExpandKeyPath(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(runtimeDir(), expanded)
+	}
+	return expanded, nil
+}
+
+// listenUnix binds a Unix socket at path with the given permissions, replacing a stale socket file
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+
+	return listener, nil
+}
+
+// removeStaleSocket deletes a Unix socket left behind by a previous run so it can be re-bound.
+// A socket something still listens on is left alone and reported as errSocketInUse.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s: %w", path, errSocketInUse)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) && !errors.Is(err, syscall.ENOENT) {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
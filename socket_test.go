@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	live := filepath.Join(dir, "live.sock")
+	listener, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+	if err := removeStaleSocket(live); !errors.Is(err, errSocketInUse) {
+		t.Errorf("removeStaleSocket(live) error = %v, want %v", err, errSocketInUse)
+	}
+	if _, err := os.Lstat(live); err != nil {
+		t.Errorf("live socket removed: %v", err)
+	}
+
+	stale := filepath.Join(dir, "stale.sock")
+	staleListener, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	staleListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	staleListener.Close()
+	if err := removeStaleSocket(stale); err != nil {
+		t.Errorf("removeStaleSocket(stale) error = %v", err)
+	}
+	if _, err := os.Lstat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale socket not removed: %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(file); err == nil {
+		t.Error("removeStaleSocket() should refuse to remove a regular file")
+	}
+	if err := removeStaleSocket(filepath.Join(dir, "missing.sock")); err != nil {
+		t.Errorf("removeStaleSocket(missing) error = %v", err)
+	}
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/exec"
 	"os/user"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,70 +19,104 @@ import (
 	"golang.org/x/term"
 )
 
+// sshConnectTimeout bounds establishing the TCP connection to a jump host
+const sshConnectTimeout = 15 * time.Second
+
 // SSHClientPool manages SSH client connections with connection pooling
 type SSHClientPool struct {
 	clients     map[string]*ssh.Client
+	dials       map[string]*clientDial // Connections in progress, keyed like clients
+	ctx         context.Context        // Cancelled by Close to abandon connections in progress
+	cancel      context.CancelFunc
 	mu          sync.Mutex
+	size        atomic.Int64 // len(clients), readable without mu
 	authMethods map[string][]ssh.AuthMethod
 	authMu      sync.Mutex
+	onHandshake func(jumpAddr string) // Called after each successful SSH handshake
+
+	onDisconnect func(jumpAddr string, err error) // Called when a pooled connection closes
+	onAuthNeeded func(keyPath string, err error)  // Called when auth methods are unavailable
+}
+
+// clientDial is a connection to a jump host in progress, shared by every caller waiting for it
+type clientDial struct {
+	done   chan struct{} // Closed once client or err is set
+	client *ssh.Client
+	err    error
+}
+
+// SSHAuth holds the settings used to authenticate to a jump host. KeyPassphrase and
+// Password may be secret references, resolved only when a connection needs them.
+type SSHAuth struct {
+	KeyPath       string
+	IdentityAgent string
+	KeyPassphrase string // Passphrase for KeyPath, instead of prompting on the terminal
+	Password      string // Password to offer if the jump host asks for one
+}
+
+// cacheKey identifies the auth methods loaded for these settings
+func (auth SSHAuth) cacheKey() string {
+	if auth.IdentityAgent != "" {
+		return auth.KeyPath + "|" + auth.IdentityAgent
+	}
+	return auth.KeyPath
 }
 
 // NewSSHClientPool creates a new SSH client pool
 func NewSSHClientPool() *SSHClientPool {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &SSHClientPool{
 		clients:     make(map[string]*ssh.Client),
+		dials:       make(map[string]*clientDial),
+		ctx:         ctx,
+		cancel:      cancel,
 		authMethods: make(map[string][]ssh.AuthMethod),
 	}
 }
 
 // LoadAuthMethods loads SSH authentication methods for the given key path and optional identity agent
-func (pool *SSHClientPool) LoadAuthMethods(keyPath, identityAgent string) error {
+func (pool *SSHClientPool) LoadAuthMethods(auth SSHAuth) error {
+	cacheKey := auth.cacheKey()
 	pool.authMu.Lock()
-	defer pool.authMu.Unlock()
-
-	cacheKey := keyPath
-	if identityAgent != "" {
-		cacheKey = keyPath + "|" + identityAgent
-	}
-
-	if _, exists := pool.authMethods[cacheKey]; exists {
+	_, exists := pool.authMethods[cacheKey]
+	pool.authMu.Unlock()
+	if exists {
 		return nil
 	}
 
-	authMethods, err := loadSSHAuthMethods(keyPath, identityAgent)
+	// Loading may resolve a passphrase, so other keys aren't held up meanwhile
+	authMethods, err := loadSSHAuthMethods(auth)
 	if err != nil {
 		return fmt.Errorf("failed to load SSH auth methods: %w", err)
 	}
 
+	pool.authMu.Lock()
 	pool.authMethods[cacheKey] = authMethods
+	pool.authMu.Unlock()
 	return nil
 }
 
 // ClearAuthMethods removes cached auth methods when agent connection becomes stale
-func (pool *SSHClientPool) ClearAuthMethods(keyPath, identityAgent string) {
+func (pool *SSHClientPool) ClearAuthMethods(auth SSHAuth) {
 	pool.authMu.Lock()
 	defer pool.authMu.Unlock()
 
-	cacheKey := keyPath
-	if identityAgent != "" {
-		cacheKey = keyPath + "|" + identityAgent
-	}
-
+	cacheKey := auth.cacheKey()
 	delete(pool.authMethods, cacheKey)
-	log.Printf("Cleared cached auth methods for %s", cacheKey)
+	slog.Info("Cleared cached auth methods", "key", cacheKey)
 }
 
-// LoadAuthMethodsWithRetry attempts to load SSH auth methods with unlimited retries
+// LoadAuthMethodsWithRetry attempts to load SSH auth methods, retrying until ctx is done
 // This is used when waiting for an SSH agent to become available (e.g., at startup)
-func (pool *SSHClientPool) LoadAuthMethodsWithRetry(keyPath, identityAgent string, retryInterval time.Duration) error {
+func (pool *SSHClientPool) LoadAuthMethodsWithRetry(ctx context.Context, auth SSHAuth, retryInterval time.Duration) error {
 	attempt := 0
 
 	for {
 		attempt++
-		err := pool.LoadAuthMethods(keyPath, identityAgent)
+		err := pool.LoadAuthMethods(auth)
 		if err == nil {
 			if attempt > 1 {
-				log.Printf("Successfully loaded SSH auth methods for %s after %d attempts", keyPath, attempt)
+				slog.Info("Loaded SSH auth methods", "key_path", auth.KeyPath, "attempts", attempt)
 			}
 			return nil
 		}
@@ -92,35 +128,90 @@ func (pool *SSHClientPool) LoadAuthMethodsWithRetry(keyPath, identityAgent strin
 
 		if !isAgentSocketError {
 			// Not an agent availability issue, fail immediately
+			if pool.onAuthNeeded != nil {
+				pool.onAuthNeeded(auth.KeyPath, err)
+			}
 			return fmt.Errorf("failed to load SSH auth methods: %w", err)
 		}
 
 		if attempt == 1 {
-			log.Printf("Waiting for SSH agent to become available (will retry every %s)...", retryInterval)
+			slog.Info("Waiting for SSH agent to become available", "retry_interval", retryInterval)
+			if pool.onAuthNeeded != nil {
+				pool.onAuthNeeded(auth.KeyPath, err)
+			}
 		} else if attempt%6 == 0 {
 			// Log every 30 seconds (6 attempts * 5s interval)
-			log.Printf("Still waiting for SSH agent... (%d attempts so far)", attempt)
+			slog.Info("Still waiting for SSH agent", "attempts", attempt)
 		}
 
-		time.Sleep(retryInterval)
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for SSH agent: %w", ctx.Err())
+		}
 	}
 }
 
-// GetClient returns an SSH client for the given jump host, creating one if needed
-func (pool *SSHClientPool) GetClient(jumpHost string, jumpPort int, keyPath, identityAgent string) (*ssh.Client, error) {
-	pool.mu.Lock()
-	defer pool.mu.Unlock()
-
+// GetClient returns an SSH client for the given jump host, creating one if needed. The
+// connection is made in the background, without holding the pool lock, since resolving
+// secrets or answering prompts can take a while; concurrent callers for the same jump host
+// share it. GetClient gives up when ctx is done, and the connection when the pool is closed.
+func (pool *SSHClientPool) GetClient(ctx context.Context, jumpHost string, jumpPort int, auth SSHAuth) (*ssh.Client, error) {
 	clientKey := fmt.Sprintf("%s:%d", jumpHost, jumpPort)
 
+	pool.mu.Lock()
 	if client, exists := pool.clients[clientKey]; exists {
+		pool.mu.Unlock()
 		return client, nil
 	}
+	dial, dialing := pool.dials[clientKey]
+	if !dialing {
+		dial = &clientDial{done: make(chan struct{})}
+		pool.dials[clientKey] = dial
+		go pool.dial(pool.ctx, clientKey, dial, jumpHost, jumpPort, auth)
+	}
+	pool.mu.Unlock()
 
-	cacheKey := keyPath
-	if identityAgent != "" {
-		cacheKey = keyPath + "|" + identityAgent
+	select {
+	case <-dial.done:
+		return dial.client, dial.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
+
+// dial connects to a jump host for GetClient and adds the client to the pool, unless the
+// pool was closed meanwhile
+func (pool *SSHClientPool) dial(ctx context.Context, clientKey string, dial *clientDial, jumpHost string, jumpPort int, auth SSHAuth) {
+	dial.client, dial.err = pool.connect(ctx, jumpHost, jumpPort, auth)
+
+	pool.mu.Lock()
+	if pool.dials[clientKey] == dial {
+		delete(pool.dials, clientKey)
+	}
+	if dial.err == nil && ctx.Err() != nil {
+		dial.client.Close()
+		dial.client, dial.err = nil, fmt.Errorf("connection to jump host %s abandoned: pool closed", clientKey)
+	}
+	if dial.err == nil {
+		pool.clients[clientKey] = dial.client
+		pool.size.Store(int64(len(pool.clients)))
+	}
+	pool.mu.Unlock()
+	close(dial.done)
+
+	if dial.err != nil {
+		return
+	}
+	if pool.onHandshake != nil {
+		pool.onHandshake(clientKey)
+	}
+	pool.watchClient(clientKey, dial.client)
+}
+
+// connect loads auth methods if needed and opens a new SSH connection to a jump host
+func (pool *SSHClientPool) connect(ctx context.Context, jumpHost string, jumpPort int, auth SSHAuth) (*ssh.Client, error) {
+	cacheKey := auth.cacheKey()
 
 	pool.authMu.Lock()
 	authMethods, exists := pool.authMethods[cacheKey]
@@ -128,19 +219,10 @@ func (pool *SSHClientPool) GetClient(jumpHost string, jumpPort int, keyPath, ide
 
 	// Lazy load auth methods if not cached
 	if !exists || len(authMethods) == 0 {
-		log.Printf("Auth methods not loaded for %s, loading now...", keyPath)
+		slog.Info("Auth methods not loaded, loading now", "key_path", auth.KeyPath)
 
-		// Unlock the main mutex while we load auth methods to avoid blocking other operations
-		pool.mu.Unlock()
-
-		// Try to load with unlimited retries (5 seconds between attempts)
-		// This will wait indefinitely for the SSH agent to become available
-		err := pool.LoadAuthMethodsWithRetry(keyPath, identityAgent, 5*time.Second)
-
-		// Re-lock before continuing
-		pool.mu.Lock()
-
-		if err != nil {
+		// Retry every 5 seconds, waiting for the SSH agent to become available until the pool is closed
+		if err := pool.LoadAuthMethodsWithRetry(ctx, auth, 5*time.Second); err != nil {
 			return nil, fmt.Errorf("failed to load SSH auth methods: %w", err)
 		}
 
@@ -150,7 +232,7 @@ func (pool *SSHClientPool) GetClient(jumpHost string, jumpPort int, keyPath, ide
 		pool.authMu.Unlock()
 
 		if len(authMethods) == 0 {
-			return nil, fmt.Errorf("no authentication methods available for key %s after loading", keyPath)
+			return nil, fmt.Errorf("no authentication methods available for key %s after loading", auth.KeyPath)
 		}
 	}
 
@@ -160,25 +242,27 @@ func (pool *SSHClientPool) GetClient(jumpHost string, jumpPort int, keyPath, ide
 		return nil, fmt.Errorf("failed to get current user: %w", err)
 	}
 
-	log.Printf("Connecting as user %s with %d auth method(s)", currentUser.Username, len(authMethods))
+	// Build jump host address with port
+	jumpAddr := fmt.Sprintf("%s:%d", jumpHost, jumpPort)
+	slog.Info("Connecting to jump host", "jump_host", jumpAddr, "user", currentUser.Username, "auth_methods", len(authMethods))
 
 	sshConfig := &ssh.ClientConfig{
 		User:            currentUser.Username,
-		Auth:            authMethods,
+		Auth:            withPassword(authMethods, auth.Password),
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 
-	// Build jump host address with port
-	jumpAddr := fmt.Sprintf("%s:%d", jumpHost, jumpPort)
-
 	// Retry SSH connection with exponential backoff for agent errors
 	var client *ssh.Client
 	maxRetries := 3
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		client, err = ssh.Dial("tcp", jumpAddr, sshConfig)
+		client, err = dialSSH(ctx, jumpAddr, sshConfig)
 		if err == nil {
 			break
 		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("connection to jump host %s abandoned: %w", jumpAddr, ctx.Err())
+		}
 
 		// Check if error is agent-related during handshake
 		errStr := err.Error()
@@ -187,41 +271,78 @@ func (pool *SSHClientPool) GetClient(jumpHost string, jumpPort int, keyPath, ide
 			strings.Contains(errStr, "EOF")
 
 		if !isAgentError || attempt == maxRetries {
+			if strings.Contains(errStr, "unable to authenticate") && pool.onAuthNeeded != nil {
+				pool.onAuthNeeded(auth.KeyPath, err)
+			}
 			return nil, fmt.Errorf("failed to dial jump host %s (attempt %d/%d): %w", jumpAddr, attempt, maxRetries, err)
 		}
 
-		// Clear stale auth methods to force reload from agent
-		pool.ClearAuthMethods(keyPath, identityAgent)
-
-		// Reload auth methods with fresh agent connection
-		pool.authMu.Lock()
-		delete(pool.authMethods, cacheKey)
-		pool.authMu.Unlock()
-
-		authMethods, err = loadSSHAuthMethods(keyPath, identityAgent)
+		// Clear stale auth methods and reload them with a fresh agent connection
+		pool.ClearAuthMethods(auth)
+		authMethods, err = loadSSHAuthMethods(auth)
 		if err != nil {
 			return nil, fmt.Errorf("failed to reload auth methods: %w", err)
 		}
 
 		pool.authMu.Lock()
 		pool.authMethods[cacheKey] = authMethods
-		sshConfig.Auth = authMethods
 		pool.authMu.Unlock()
+		sshConfig.Auth = withPassword(authMethods, auth.Password)
 
 		delay := time.Duration(attempt*3) * time.Second
-		log.Printf("SSH connection failed (attempt %d/%d): %v. Retrying with fresh agent connection in %s...",
-			attempt, maxRetries, err, delay)
+		slog.Warn("SSH connection failed, retrying with fresh agent connection",
+			"jump_host", jumpAddr, "attempt", attempt, "max_attempts", maxRetries, "retry_in", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connection to jump host %s abandoned: %w", jumpAddr, ctx.Err())
+		}
+	}
 
-		// Unlock to allow other operations while we wait
-		pool.mu.Unlock()
-		time.Sleep(delay)
-		pool.mu.Lock()
+	slog.Info("SSH connection established", "jump_host", jumpAddr, "user", currentUser.Username)
+	return client, nil
+}
+
+// dialSSH connects and authenticates to an SSH server. Connecting times out after
+// sshConnectTimeout; the handshake, which may wait on prompts, only ends early if ctx does.
+func dialSSH(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	dialer := net.Dialer{Timeout: sshConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
 	}
 
-	pool.clients[clientKey] = client
-	log.Printf("SSH connection established to %s as %s", jumpAddr, currentUser.Username)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !stop() {
+		if err == nil {
+			sshConn.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
 
-	return client, nil
+// watchClient drops a client from the pool once its connection closes, so the next
+// GetClient reconnects instead of dialing through a dead connection
+func (pool *SSHClientPool) watchClient(clientKey string, client *ssh.Client) {
+	err := client.Wait()
+
+	pool.mu.Lock()
+	if pool.clients[clientKey] == client {
+		delete(pool.clients, clientKey)
+		pool.size.Store(int64(len(pool.clients)))
+	}
+	pool.mu.Unlock()
+
+	slog.Info("SSH connection closed", "jump_host", clientKey, "error", err)
+	if pool.onDisconnect != nil {
+		pool.onDisconnect(clientKey, err)
+	}
 }
 
 // RemoveClient removes a stale client from the pool
@@ -233,19 +354,32 @@ func (pool *SSHClientPool) RemoveClient(jumpHost string, jumpPort int) {
 	if client, exists := pool.clients[clientKey]; exists {
 		client.Close()
 		delete(pool.clients, clientKey)
-		log.Printf("Removed stale SSH connection to %s", clientKey)
+		pool.size.Store(int64(len(pool.clients)))
+		slog.Info("Removed stale SSH connection", "jump_host", clientKey)
 	}
 }
 
-// Close closes all SSH clients in the pool
+// Size returns the number of open SSH clients in the pool
+func (pool *SSHClientPool) Size() int {
+	return int(pool.size.Load())
+}
+
+// Close closes all SSH clients in the pool; the pool can be reused afterwards. Connections
+// still being made are closed once they're established.
 func (pool *SSHClientPool) Close() {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
+	pool.cancel()
+	pool.ctx, pool.cancel = context.WithCancel(context.Background())
+	pool.dials = make(map[string]*clientDial)
+
 	for jumpAddr, client := range pool.clients {
-		log.Printf("Closing connection to %s", jumpAddr)
+		slog.Info("Closing SSH connection", "jump_host", jumpAddr)
 		client.Close()
 	}
+	pool.clients = make(map[string]*ssh.Client)
+	pool.size.Store(0)
 }
 
 // ExpandKeyPath expands ~ in key paths to the home directory
@@ -267,8 +401,21 @@ func ExpandKeyPath(keyPath string) (string, error) {
 	return keyPath, nil
 }
 
+// withPassword adds password authentication to auth methods if a password is configured.
+// The password is resolved when the server asks for it, not before.
+func withPassword(authMethods []ssh.AuthMethod, password string) []ssh.AuthMethod {
+	if password == "" {
+		return authMethods
+	}
+	methods := append([]ssh.AuthMethod(nil), authMethods...)
+	return append(methods, ssh.PasswordCallback(func() (string, error) {
+		return resolveSecret(password)
+	}))
+}
+
 // loadSSHAuthMethods loads SSH authentication methods from agent or key file
-func loadSSHAuthMethods(keyPath, identityAgent string) ([]ssh.AuthMethod, error) {
+func loadSSHAuthMethods(auth SSHAuth) ([]ssh.AuthMethod, error) {
+	keyPath, identityAgent := auth.KeyPath, auth.IdentityAgent
 	authMethods := make([]ssh.AuthMethod, 0)
 
 	// Priority: identity_agent config > SSH_AUTH_SOCK env > key file
@@ -276,17 +423,17 @@ func loadSSHAuthMethods(keyPath, identityAgent string) ([]ssh.AuthMethod, error)
 	if identityAgent != "" {
 		expandedAgent, err := ExpandKeyPath(identityAgent)
 		if err != nil {
-			log.Printf("Failed to expand identity agent path %s: %v", identityAgent, err)
+			slog.Warn("Failed to expand identity agent path", "identity_agent", identityAgent, "error", err)
 		} else {
 			agentSocket = expandedAgent
-			log.Printf("Using configured identity agent: %s", agentSocket)
+			slog.Info("Using configured identity agent", "identity_agent", agentSocket)
 		}
 	}
 
 	if agentSocket == "" {
 		if sshAuthSock := os.Getenv("SSH_AUTH_SOCK"); sshAuthSock != "" {
 			agentSocket = sshAuthSock
-			log.Printf("Using SSH_AUTH_SOCK agent")
+			slog.Info("Using SSH_AUTH_SOCK agent")
 		}
 	}
 
@@ -297,7 +444,7 @@ func loadSSHAuthMethods(keyPath, identityAgent string) ([]ssh.AuthMethod, error)
 			signers, err := agentClient.Signers()
 			if err == nil && len(signers) > 0 {
 				authMethods = append(authMethods, ssh.PublicKeys(signers...))
-				log.Printf("SSH agent connected with %d key(s)", len(signers))
+				slog.Info("SSH agent connected", "keys", len(signers))
 				authMethods = append(authMethods, ssh.KeyboardInteractive(keyboardInteractiveChallenge))
 				return authMethods, nil
 			}
@@ -308,7 +455,7 @@ func loadSSHAuthMethods(keyPath, identityAgent string) ([]ssh.AuthMethod, error)
 			if identityAgent == "" && keyPath != "" {
 				expandedKeyPath, err := ExpandKeyPath(keyPath)
 				if err == nil {
-					log.Printf("Agent has no keys, attempting to load %s from macOS Keychain", expandedKeyPath)
+					slog.Info("Agent has no keys, attempting to load key from macOS Keychain", "key_path", expandedKeyPath)
 					cmd := exec.Command("ssh-add", "--apple-use-keychain", expandedKeyPath)
 					cmd.Stdin = nil
 					if err := cmd.Run(); err == nil {
@@ -319,24 +466,24 @@ func loadSSHAuthMethods(keyPath, identityAgent string) ([]ssh.AuthMethod, error)
 							signers, err := agentClient.Signers()
 							if err == nil && len(signers) > 0 {
 								authMethods = append(authMethods, ssh.PublicKeys(signers...))
-								log.Printf("SSH agent loaded with %d key(s) from Keychain", len(signers))
+								slog.Info("SSH agent loaded keys from Keychain", "keys", len(signers))
 								authMethods = append(authMethods, ssh.KeyboardInteractive(keyboardInteractiveChallenge))
 								return authMethods, nil
 							}
 							agentConn.Close()
 						}
 					} else {
-						log.Printf("Failed to load key from Keychain: %v", err)
+						slog.Warn("Failed to load key from Keychain", "error", err)
 					}
 				}
 			}
 		} else {
-			log.Printf("Failed to connect to SSH agent at %s: %v", agentSocket, err)
+			slog.Warn("Failed to connect to SSH agent", "identity_agent", agentSocket, "error", err)
 		}
 	}
 
 	// Fall back to key file
-	log.Printf("SSH agent has no keys, loading from key file...")
+	slog.Info("SSH agent has no keys, loading from key file")
 	expandedKeyPath, err := ExpandKeyPath(keyPath)
 	if err != nil {
 		return nil, err
@@ -352,11 +499,9 @@ func loadSSHAuthMethods(keyPath, identityAgent string) ([]ssh.AuthMethod, error)
 	if err != nil {
 		// Check if it's a passphrase-protected key
 		if _, ok := err.(*ssh.PassphraseMissingError); ok {
-			fmt.Printf("Enter passphrase for %s: ", keyPath)
-			passphrase, err := term.ReadPassword(int(syscall.Stdin))
-			fmt.Println() // Print newline after password input
+			passphrase, err := keyPassphrase(keyPath, auth.KeyPassphrase)
 			if err != nil {
-				return nil, fmt.Errorf("failed to read passphrase: %w", err)
+				return nil, err
 			}
 			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
 			if err != nil {
@@ -370,10 +515,30 @@ func loadSSHAuthMethods(keyPath, identityAgent string) ([]ssh.AuthMethod, error)
 	authMethods = append(authMethods, ssh.PublicKeys(signer))
 	// Add keyboard-interactive for 2FA support
 	authMethods = append(authMethods, ssh.KeyboardInteractive(keyboardInteractiveChallenge))
-	log.Printf("Loaded SSH key from %s", keyPath)
+	slog.Info("Loaded SSH key", "key_path", keyPath)
 	return authMethods, nil
 }
 
+// keyPassphrase resolves the configured passphrase for a key, or prompts for it on the
+// terminal if none is configured
+func keyPassphrase(keyPath, configured string) ([]byte, error) {
+	if configured != "" {
+		passphrase, err := resolveSecret(configured)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get passphrase for %s: %w", keyPath, err)
+		}
+		return []byte(passphrase), nil
+	}
+
+	fmt.Printf("Enter passphrase for %s: ", keyPath)
+	passphrase, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println() // Print newline after password input
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
+
 // keyboardInteractiveChallenge handles keyboard-interactive authentication challenges
 func keyboardInteractiveChallenge(user, instruction string, questions []string, echos []bool) ([]string, error) {
 	if len(questions) == 0 {
@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
+	"os"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 func TestExpandKeyPath(t *testing.T) {
@@ -67,6 +74,114 @@ func TestNewSSHClientPool(t *testing.T) {
 	}
 }
 
+func TestSSHClientPoolSizeDuringHandshake(t *testing.T) {
+	pool := NewSSHClientPool()
+
+	// Watching a connection close takes the pool lock
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	size := make(chan int, 1)
+	go func() { size <- pool.Size() }()
+	select {
+	case n := <-size:
+		if n != 0 {
+			t.Errorf("Size() = %d, want 0", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Size() blocked on a connection in progress")
+	}
+}
+
+func TestGetClientDoesNotBlockOtherJumpHosts(t *testing.T) {
+	// A jump host that accepts connections but never completes the handshake
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := stalled.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refusedPort := refused.Addr().(*net.TCPAddr).Port
+	refused.Close()
+
+	pool := NewSSHClientPool()
+	auth := SSHAuth{KeyPath: "test"}
+	pool.authMethods[auth.cacheKey()] = []ssh.AuthMethod{ssh.Password("secret")}
+
+	stalledPort := stalled.Addr().(*net.TCPAddr).Port
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.GetClient(context.Background(), "127.0.0.1", stalledPort, auth)
+		done <- err
+	}()
+	conn := <-accepted
+
+	// Another jump host fails on its own while the first is still connecting
+	if _, err := pool.GetClient(context.Background(), "127.0.0.1", refusedPort, auth); err == nil {
+		t.Error("GetClient() to a closed port succeeded")
+	}
+
+	conn.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("GetClient() to a stalled jump host succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetClient() did not return after the jump host closed the connection")
+	}
+}
+
+func TestGetClientGivesUp(t *testing.T) {
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := stalled.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	pool := NewSSHClientPool()
+	auth := SSHAuth{KeyPath: "test"}
+	pool.authMethods[auth.cacheKey()] = []ssh.AuthMethod{ssh.Password("secret")}
+
+	// The caller gives up when its context ends, even though the handshake hasn't
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = pool.GetClient(ctx, "127.0.0.1", stalled.Addr().(*net.TCPAddr).Port, auth)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetClient() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Closing the pool abandons the handshake itself
+	conn := <-accepted
+	defer conn.Close()
+	pool.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, err := conn.Read(make([]byte, 1024)); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Error("connection still open after the pool was closed")
+			}
+			break
+		}
+	}
+}
+
 func TestKeyboardInteractiveChallenge(t *testing.T) {
 	// Test with empty questions
 	answers, err := keyboardInteractiveChallenge("user", "instruction", []string{}, []bool{})
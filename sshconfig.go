@@ -0,0 +1,755 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSSHConfigPath is the OpenSSH client config read by portsmith import ssh-config
+const DefaultSSHConfigPath = "~/.ssh/config"
+
+// maxSSHIncludeDepth matches the limit ssh puts on nested Include directives
+const maxSSHIncludeDepth = 16
+
+// sshOption is a keyword and its arguments from an OpenSSH client config
+type sshOption struct {
+	key      string // Lowercased, since ssh keywords are case-insensitive
+	args     []string
+	position string // file:line, for warnings
+}
+
+// sshConfigBlock is a Host block with its options in the order they appear
+type sshConfigBlock struct {
+	patterns []string
+	options  []sshOption
+}
+
+// sshConfigParser reads an OpenSSH client config and the files it includes into Host blocks
+type sshConfigParser struct {
+	dir      string // Relative Include paths are resolved against the directory of the main file
+	blocks   []sshConfigBlock
+	current  *sshConfigBlock // nil inside a Match block, whose options are skipped
+	warnings []string
+}
+
+// parseSSHConfig reads an OpenSSH client config into Host blocks. Options before the first
+// Host apply to every host, as they do in ssh. Match blocks can't be evaluated without
+// connecting, so they're skipped with a warning.
+func parseSSHConfig(path string) ([]sshConfigBlock, []string, error) {
+	p := &sshConfigParser{
+		dir:    filepath.Dir(path),
+		blocks: []sshConfigBlock{{patterns: []string{"*"}}},
+	}
+	p.current = &p.blocks[0]
+	if err := p.parseFile(path, 0); err != nil {
+		return nil, nil, err
+	}
+	return p.blocks, p.warnings, nil
+}
+
+// parseFile adds the blocks and options of one file, following its Include directives in place
+func (p *sshConfigParser) parseFile(file string, depth int) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read ssh config: %w", err)
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		position := fmt.Sprintf("%s:%d", file, i+1)
+		key, args, err := splitSSHConfigLine(line)
+		if err != nil {
+			return fmt.Errorf("%s: %w", position, err)
+		}
+
+		switch key {
+		case "host":
+			p.blocks = append(p.blocks, sshConfigBlock{patterns: args})
+			p.current = &p.blocks[len(p.blocks)-1]
+		case "match":
+			p.current = nil
+			p.warnings = append(p.warnings, fmt.Sprintf("%s: Match blocks aren't supported, skipping to the next Host", position))
+		case "include":
+			if p.current == nil {
+				continue
+			}
+			if depth >= maxSSHIncludeDepth {
+				return fmt.Errorf("%s: Include nested more than %d deep", position, maxSSHIncludeDepth)
+			}
+			for _, pattern := range args {
+				if err := p.include(pattern, depth); err != nil {
+					return fmt.Errorf("%s: %w", position, err)
+				}
+			}
+		default:
+			if p.current != nil {
+				p.current.options = append(p.current.options, sshOption{key: key, args: args, position: position})
+			}
+		}
+	}
+	return nil
+}
+
+// include parses the files matching an Include pattern. As in ssh, a pattern that matches
+// nothing is ignored.
+func (p *sshConfigParser) include(pattern string, depth int) error {
+	expanded, err := ExpandKeyPath(pattern)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(p.dir, expanded)
+	}
+	matches, err := filepath.Glob(expanded)
+	if err != nil {
+		return fmt.Errorf("invalid Include %q: %w", pattern, err)
+	}
+	for _, match := range matches {
+		if err := p.parseFile(match, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSSHConfigLine splits a config line into its lowercased keyword and arguments. The
+// keyword may be followed by whitespace or "=", and arguments may be double-quoted.
+func splitSSHConfigLine(line string) (string, []string, error) {
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	var arg strings.Builder
+	inArg, quoted := false, false
+	for _, c := range rest {
+		switch {
+		case c == '"':
+			quoted, inArg = !quoted, true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return "", nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return key, args, nil
+}
+
+// matchesSSHPatterns reports whether a Host line's patterns select alias: at least one
+// pattern must match and no negated (!) pattern may
+func matchesSSHPatterns(patterns []string, alias string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		ok, err := path.Match(strings.ToLower(strings.TrimPrefix(pattern, "!")), strings.ToLower(alias))
+		if err != nil || !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// sshAliases returns the names hosts can be reached by with ssh: the first pattern of each
+// Host line without wildcards, in order
+func sshAliases(blocks []sshConfigBlock) []string {
+	var aliases []string
+	seen := make(map[string]bool)
+	for _, block := range blocks[1:] {
+		for _, pattern := range block.patterns {
+			if strings.ContainsAny(pattern, "*?!") {
+				continue
+			}
+			if !seen[pattern] {
+				seen[pattern] = true
+				aliases = append(aliases, pattern)
+			}
+			break
+		}
+	}
+	return aliases
+}
+
+// sshHostOptions collects the options that apply to alias from every block it matches,
+// keyed by keyword in the order ssh would see them. Like ssh, callers use the first value
+// of most keywords, while LocalForward accumulates.
+func sshHostOptions(blocks []sshConfigBlock, alias string) map[string][]sshOption {
+	options := make(map[string][]sshOption)
+	for _, block := range blocks {
+		if !matchesSSHPatterns(block.patterns, alias) {
+			continue
+		}
+		for _, option := range block.options {
+			options[option.key] = append(options[option.key], option)
+		}
+	}
+	return options
+}
+
+// sshForward is a LocalForward: a local port or Unix socket forwarded to a host and port,
+// or to a socket, on the far side of the SSH connection
+type sshForward struct {
+	bindAddress  string
+	listenPort   int
+	listenSocket string
+	targetHost   string
+	targetPort   int
+	targetSocket string
+}
+
+// parseLocalForward parses LocalForward's arguments: a listener ([bind_address:]port or a
+// socket path) and a destination (host:hostport or a socket path)
+func parseLocalForward(args []string) (sshForward, error) {
+	var forward sshForward
+	if len(args) != 2 {
+		return forward, fmt.Errorf("expected a listener and a destination, got %q", strings.Join(args, " "))
+	}
+	listen, target := args[0], args[1]
+
+	if strings.Contains(listen, "/") {
+		forward.listenSocket = listen
+	} else {
+		if strings.Contains(listen, ":") {
+			bindAddress, port, err := net.SplitHostPort(listen)
+			if err != nil {
+				return forward, fmt.Errorf("invalid listener %q: %w", listen, err)
+			}
+			forward.bindAddress, listen = bindAddress, port
+		}
+		port, err := parseForwardPort(listen)
+		if err != nil {
+			return forward, err
+		}
+		forward.listenPort = port
+	}
+
+	if strings.Contains(target, "/") {
+		forward.targetSocket = target
+		return forward, nil
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return forward, fmt.Errorf("invalid destination %q: %w", target, err)
+	}
+	forward.targetHost = host
+	forward.targetPort, err = parseForwardPort(port)
+	return forward, err
+}
+
+// parseForwardPort parses a port number from a LocalForward
+func parseForwardPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, validatePort(port)
+}
+
+// sshConfigHosts converts the LocalForwards of each Host in an ssh config into portsmith
+// hosts: one per destination host or socket, jumping through the Host's HostName. The
+// first host of an alias is named after it and later ones get a numeric suffix. Settings
+// portsmith can't reproduce are returned as warnings.
+func sshConfigHosts(blocks []sshConfigBlock, username string) ([]HostConfig, []string) {
+	var hosts []HostConfig
+	var warnings []string
+
+	for _, alias := range sshAliases(blocks) {
+		options := sshHostOptions(blocks, alias)
+		forwards := options["localforward"]
+		if len(forwards) == 0 {
+			continue
+		}
+		first := func(key string) string {
+			if values := options[key]; len(values) > 0 && len(values[0].args) > 0 {
+				return values[0].args[0]
+			}
+			return ""
+		}
+		warn := func(format string, args ...any) {
+			warnings = append(warnings, fmt.Sprintf("Host %s: ", alias)+fmt.Sprintf(format, args...))
+		}
+
+		base := HostConfig{JumpHost: alias}
+		if hostName := first("hostname"); hostName != "" {
+			base.JumpHost = strings.NewReplacer("%h", alias, "%%", "%").Replace(hostName)
+		}
+		if port := first("port"); port != "" {
+			n, err := strconv.Atoi(port)
+			if err != nil || validatePort(n) != nil {
+				warn("skipping, invalid Port %q", port)
+				continue
+			}
+			if n != SSHDefaultPort {
+				base.JumpPort = n
+			}
+		}
+		if identityFile := first("identityfile"); identityFile != "" && !strings.EqualFold(identityFile, "none") {
+			base.KeyPath = strings.ReplaceAll(identityFile, "%d", "~")
+		}
+		if agent := first("identityagent"); agent != "" && !strings.EqualFold(agent, "none") && agent != "SSH_AUTH_SOCK" {
+			base.IdentityAgent = agent
+		}
+		for _, keyword := range []string{"ProxyJump", "ProxyCommand"} {
+			if value := first(strings.ToLower(keyword)); value != "" && !strings.EqualFold(value, "none") {
+				warn("%s isn't supported, portsmith will connect to %s directly", keyword, base.JumpHost)
+			}
+		}
+		if login := first("user"); login != "" && login != username {
+			warn("connects as %s, but portsmith connects as the current user (%s)", login, username)
+		}
+
+		var group []*HostConfig
+		byTarget := make(map[string]*HostConfig)
+		for _, option := range forwards {
+			forward, err := parseLocalForward(option.args)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: skipping LocalForward: %v", option.position, err))
+				continue
+			}
+
+			target := "host " + forward.targetHost
+			if forward.targetSocket != "" {
+				target = "socket " + forward.targetSocket
+			}
+			// Hosts listen on their own loopback address, on the destination's port
+			if forward.bindAddress != "" {
+				warnings = append(warnings, fmt.Sprintf("%s: ignoring bind address %s, portsmith listens on the host's own loopback address",
+					option.position, forward.bindAddress))
+			}
+			if forward.listenPort != 0 && forward.targetPort != 0 && forward.listenPort != forward.targetPort {
+				warnings = append(warnings, fmt.Sprintf("%s: portsmith listens on port %d rather than %d, so clients must use %d",
+					option.position, forward.targetPort, forward.listenPort, forward.targetPort))
+			}
+
+			host, exists := byTarget[target]
+			if !exists {
+				host = new(HostConfig)
+				*host = base
+				host.RemoteHost, host.RemoteSocket = forward.targetHost, forward.targetSocket
+				byTarget[target] = host
+				group = append(group, host)
+			}
+
+			switch {
+			case forward.targetSocket != "" && forward.listenSocket != "":
+				if host.LocalSocket != "" && host.LocalSocket != forward.listenSocket {
+					warnings = append(warnings, fmt.Sprintf("%s: skipping LocalForward, %s is already exposed on %s",
+						option.position, forward.targetSocket, host.LocalSocket))
+					continue
+				}
+				host.LocalSocket = forward.listenSocket
+			case forward.targetSocket != "":
+				host.Ports = append(host.Ports, forward.listenPort)
+			case forward.listenSocket != "":
+				host.Ports = append(host.Ports, map[string]interface{}{"port": forward.targetPort, "listen_socket": forward.listenSocket})
+			default:
+				host.Ports = append(host.Ports, forward.targetPort)
+			}
+		}
+
+		for i, host := range group {
+			host.Name = alias
+			if i > 0 {
+				host.Name = fmt.Sprintf("%s-%d", alias, i+1)
+			}
+			// A destination that is an address, or the jump host itself, says nothing about what
+			// the service is, so it's reached by the alias instead
+			if listensOnLocalIP(*host) && (host.RemoteHost == "" || isIPAddress(host.RemoteHost) || strings.EqualFold(host.RemoteHost, "localhost")) {
+				host.Hostnames = []string{host.Name}
+			}
+			hosts = append(hosts, *host)
+		}
+	}
+	return hosts, warnings
+}
+
+// listensOnLocalIP reports whether any of a host's ports is exposed on its local_ip rather
+// than a Unix socket
+func listensOnLocalIP(host HostConfig) bool {
+	for _, port := range host.Ports {
+		if _, isPort := port.(int); isPort {
+			return true
+		}
+	}
+	return false
+}
+
+// configHostNames returns the names and local IPs already used by a config's hosts,
+// across every profile. A host without a name is counted under the name LoadConfig would
+// give it.
+func configHostNames(doc *configDocument) (map[string]bool, map[string]bool) {
+	names := make(map[string]bool)
+	localIPs := make(map[string]bool)
+
+	nodes := append(hostList(nil), doc.hosts...)
+	for _, name := range doc.profileOrder {
+		nodes = append(nodes, doc.profileHosts(name)...)
+	}
+	for _, host := range nodes {
+		if ip := scalarValue(host.node, "local_ip"); ip != "" {
+			localIPs[ip] = true
+		}
+		name := scalarValue(host.node, "name")
+		if hostnames := mappingValue(host.node, "hostnames"); name == "" && len(hostnames.Content) > 0 {
+			name = hostnames.Content[0].Value
+		}
+		if remote := scalarValue(host.node, "remote_host"); name == "" && !isIPAddress(remote) {
+			name = remote
+		}
+		if name != "" {
+			names[name] = true
+		}
+	}
+	return names, localIPs
+}
+
+// allocateLocalIPs gives each host that listens on a local IP the next free loopback
+// address from 127.0.0.2 up
+func allocateLocalIPs(hosts []HostConfig, used map[string]bool) error {
+	next := 2
+	for i := range hosts {
+		if !listensOnLocalIP(hosts[i]) {
+			continue
+		}
+		for ; next < 255 && used[fmt.Sprintf("127.0.0.%d", next)]; next++ {
+		}
+		if next == 255 {
+			return fmt.Errorf("no free loopback address for %s: 127.0.0.2 to 127.0.0.254 are all in use", hosts[i].Name)
+		}
+		hosts[i].LocalIP = fmt.Sprintf("127.0.0.%d", next)
+		next++
+	}
+	return nil
+}
+
+// importSSHConfig reads the hosts to add from an ssh config. Hosts named like one already
+// in the portsmith config at configPath are skipped, and the rest get loopback addresses
+// that config doesn't use. configPath may be empty when there's no config yet.
+func importSSHConfig(sshPath, configPath string) ([]HostConfig, []string, error) {
+	blocks, warnings, err := parseSSHConfig(sshPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	username := ""
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	imported, conversionWarnings := sshConfigHosts(blocks, username)
+	warnings = append(warnings, conversionWarnings...)
+
+	names, localIPs := map[string]bool{}, map[string]bool{}
+	if configPath != "" {
+		doc, err := loadConfigDocument(configPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		names, localIPs = configHostNames(doc)
+	}
+
+	var hosts []HostConfig
+	for _, host := range imported {
+		if names[host.Name] {
+			warnings = append(warnings, fmt.Sprintf("Host %s: skipping, the config already has a host named %s", host.Name, host.Name))
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	if err := allocateLocalIPs(hosts, localIPs); err != nil {
+		return nil, nil, err
+	}
+	return hosts, warnings, nil
+}
+
+// compactHostNode encodes a host as YAML with only the settings that differ from a zero
+// HostConfig, so generated entries read like hand-written ones. Lists are written inline.
+func compactHostNode(host HostConfig) (*yaml.Node, error) {
+	node, zero := &yaml.Node{}, &yaml.Node{}
+	if err := node.Encode(host); err != nil {
+		return nil, fmt.Errorf("failed to encode host %s: %w", host.Name, err)
+	}
+	if err := zero.Encode(HostConfig{}); err != nil {
+		return nil, fmt.Errorf("failed to encode host %s: %w", host.Name, err)
+	}
+	pruneZeroValues(node, zero)
+	return node, nil
+}
+
+// pruneZeroValues removes the entries of a mapping that are the same as in zero, or empty,
+// reporting whether anything is left of node
+func pruneZeroValues(node, zero *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Tag != "!!null" && (zero.Kind != yaml.ScalarNode || node.Value != zero.Value)
+	case yaml.SequenceNode:
+		node.Style = yaml.FlowStyle
+		return len(node.Content) > 0
+	case yaml.MappingNode:
+		var content []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if pruneZeroValues(node.Content[i+1], mappingValue(zero, node.Content[i].Value)) {
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = content
+		return len(content) > 0
+	}
+	return true
+}
+
+// hostsSequence encodes hosts as a YAML list, each entry headed by comment
+func hostsSequence(hosts []HostConfig, comment string) (*yaml.Node, error) {
+	sequence := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, host := range hosts {
+		node, err := compactHostNode(host)
+		if err != nil {
+			return nil, err
+		}
+		node.HeadComment = comment
+		sequence.Content = append(sequence.Content, node)
+	}
+	return sequence, nil
+}
+
+// encodeYAML renders a node with the two-space indentation config files use
+func encodeYAML(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// insertHosts adds host entries to the end of the top-level hosts list in a config file's
+// content. The text is edited rather than the YAML re-encoded, so the file's comments,
+// blank lines and formatting are kept. A hosts list written inline can't be extended this way.
+func insertHosts(content []byte, sequence *yaml.Node) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		lines[len(lines)-1] += "\n"
+	}
+
+	var root *yaml.Node
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if root != nil && root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("top level is not a mapping")
+	}
+
+	// Find the hosts list, and the line the next top-level key starts on
+	var hosts *yaml.Node
+	var hostsKey *yaml.Node
+	end := len(lines)
+	if root != nil {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == "hosts" {
+				hostsKey, hosts = root.Content[i], root.Content[i+1]
+				if i+2 < len(root.Content) {
+					end = root.Content[i+2].Line - 1
+				}
+				break
+			}
+		}
+	}
+
+	var indent int
+	switch {
+	case hosts == nil:
+		lines = append(lines, "\n", "hosts:\n")
+		hosts = &yaml.Node{}
+		end, indent = len(lines), 2
+	case hosts.Kind == yaml.ScalarNode && hosts.Tag == "!!null":
+		end, indent = hostsKey.Line, 2
+	case hosts.Kind == yaml.SequenceNode && hosts.Style&yaml.FlowStyle == 0 && len(hosts.Content) > 0:
+		indent = hosts.Column - 1
+		// Comments and blank lines at the top level before the next key belong to it
+		for end > hostsKey.Line && (strings.TrimSpace(lines[end-1]) == "" || strings.HasPrefix(lines[end-1], "#")) {
+			end--
+		}
+	default:
+		return nil, fmt.Errorf("hosts must be a block list (one \"- \" entry per host) to add hosts to it")
+	}
+
+	// Entries are separated by blank lines, like the hand-written ones
+	var inserted []string
+	for i, node := range sequence.Content {
+		entry, err := encodeYAML(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{node}})
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 || hosts.Kind == yaml.SequenceNode {
+			inserted = append(inserted, "\n")
+		}
+		for _, line := range strings.SplitAfter(string(entry), "\n") {
+			if line != "" {
+				inserted = append(inserted, strings.Repeat(" ", indent)+line)
+			}
+		}
+	}
+
+	result := append(append(append([]string(nil), lines[:end]...), inserted...), lines[end:]...)
+	return []byte(strings.Join(result, "")), nil
+}
+
+// writeImportedHosts adds hosts to a config file, keeping its comments. The new file is
+// only put in place once it loads, so a mistake can't break the running config.
+func writeImportedHosts(path string, hosts []HostConfig, comment string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	sequence, err := hostsSequence(hosts, comment)
+	if err != nil {
+		return err
+	}
+	updated, err := insertHosts(content, sequence)
+	if err != nil {
+		return fmt.Errorf("failed to add hosts to %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(updated); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if _, err := LoadConfig(tmp.Name()); err != nil {
+		return fmt.Errorf("config with the imported hosts doesn't load, leaving %s unchanged: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// runImport converts another tool's config into portsmith hosts. Only ssh-config is
+// supported: each Host with LocalForward lines becomes hosts forwarding the same ports.
+func runImport(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: portsmith import ssh-config [--write] [--config config.yaml] [ssh_config]")
+		fmt.Fprintln(os.Stderr, "\nConverts the LocalForward lines of each Host in ssh_config (default "+DefaultSSHConfigPath+")")
+		fmt.Fprintln(os.Stderr, "into hosts with their own loopback address, and prints them or adds them to the config.")
+	}
+	if len(args) == 0 || args[0] != "ssh-config" {
+		usage()
+		return 2
+	}
+
+	flags := flag.NewFlagSet("import ssh-config", flag.ExitOnError)
+	configFlag := flags.String("config", "", "portsmith config to allocate addresses against and write to (default: the one the tray app loads)")
+	write := flags.Bool("write", false, "add the hosts to the config instead of printing them")
+	flags.Usage = func() {
+		usage()
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	sshPath, err := ExpandKeyPath(DefaultSSHConfigPath)
+	if flags.NArg() > 0 {
+		sshPath, err = flags.Arg(0), nil
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Without a config there's nothing to allocate against, which is fine for printing
+	configPath, err := commandConfigPath(*configFlag)
+	if err != nil && (*write || *configFlag != "") {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	hosts, warnings, err := importSSHConfig(sshPath, configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(os.Stderr, "No LocalForward lines to import from %s\n", sshPath)
+		return 0
+	}
+
+	comment := "Imported from " + sshPath
+	if *write {
+		if err := writeImportedHosts(configPath, hosts, comment); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Added %d host(s) to %s\n", len(hosts), configPath)
+		return 0
+	}
+
+	sequence, err := hostsSequence(hosts, comment)
+	if err == nil {
+		var output []byte
+		output, err = encodeYAML(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalarNode("hosts"), sequence}})
+		os.Stdout.Write(output)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
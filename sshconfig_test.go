@@ -0,0 +1,313 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSSHConfigLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		wantKey  string
+		wantArgs []string
+		wantErr  bool
+	}{
+		{"HostName bastion.example.com", "hostname", []string{"bastion.example.com"}, false},
+		{"Port=2222", "port", []string{"2222"}, false},
+		{"Port = 2222", "port", []string{"2222"}, false},
+		{"LocalForward\t5432  db.internal:5432", "localforward", []string{"5432", "db.internal:5432"}, false},
+		{`IdentityFile "~/.ssh/my key"`, "identityfile", []string{"~/.ssh/my key"}, false},
+		{"Host", "host", nil, false},
+		{`IdentityFile "~/.ssh/key`, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			key, args, err := splitSSHConfigLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if key != tt.wantKey || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got %q %q, want %q %q", key, args, tt.wantKey, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParseLocalForward(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    sshForward
+		wantErr bool
+	}{
+		{"port", []string{"5432", "db.internal:5432"}, sshForward{listenPort: 5432, targetHost: "db.internal", targetPort: 5432}, false},
+		{"bind address", []string{"127.0.0.1:6380", "cache:6379"}, sshForward{bindAddress: "127.0.0.1", listenPort: 6380, targetHost: "cache", targetPort: 6379}, false},
+		{"IPv6", []string{"[::1]:8080", "[fd00::1]:80"}, sshForward{bindAddress: "::1", listenPort: 8080, targetHost: "fd00::1", targetPort: 80}, false},
+		{"sockets", []string{"/tmp/docker.sock", "/var/run/docker.sock"}, sshForward{listenSocket: "/tmp/docker.sock", targetSocket: "/var/run/docker.sock"}, false},
+		{"port to socket", []string{"2375", "/var/run/docker.sock"}, sshForward{listenPort: 2375, targetSocket: "/var/run/docker.sock"}, false},
+		{"one argument", []string{"5432:db:5432"}, sshForward{}, true},
+		{"port out of range", []string{"5432", "db:70000"}, sshForward{}, true},
+		{"missing port", []string{"5432", "db"}, sshForward{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLocalForward(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHConfigHosts(t *testing.T) {
+	dir := t.TempDir()
+	sshPath := filepath.Join(dir, "config")
+	files := map[string]string{
+		"config": `# Options before the first Host apply to every host
+IdentityFile ~/.ssh/work
+
+Include conf.d/*
+
+Host db database
+  HostName bastion.example.com
+  Port 2222
+  User alice
+  LocalForward 5432 db.internal:5432
+  LocalForward 127.0.0.1:6380 db.internal:6379
+  LocalForward 9000 localhost:9000
+  LocalForward /tmp/docker.sock /var/run/docker.sock
+
+Match host db
+  LocalForward 1111 ignored:1111
+
+Host plain
+  HostName plain.example.com
+
+Host d* !plain
+  User deploy
+`,
+		"conf.d/web": `Host web
+  HostName=%h.example.com
+  IdentityFile ~/.ssh/web
+  LocalForward 8443 10.0.0.5:443
+  LocalForward /tmp/api.sock api.internal:80
+  ProxyJump gateway
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocks, warnings, err := parseSSHConfig(sshPath)
+	if err != nil {
+		t.Fatalf("parseSSHConfig() error = %v", err)
+	}
+	hosts, conversionWarnings := sshConfigHosts(blocks, "deploy")
+	warnings = append(warnings, conversionWarnings...)
+
+	want := []HostConfig{
+		{Name: "web", Hostnames: []string{"web"}, RemoteHost: "10.0.0.5", JumpHost: "web.example.com", KeyPath: "~/.ssh/work", Ports: []interface{}{443}},
+		{Name: "web-2", RemoteHost: "api.internal", JumpHost: "web.example.com", KeyPath: "~/.ssh/work",
+			Ports: []interface{}{map[string]interface{}{"port": 80, "listen_socket": "/tmp/api.sock"}}},
+		{Name: "db", RemoteHost: "db.internal", JumpHost: "bastion.example.com", JumpPort: 2222, KeyPath: "~/.ssh/work", Ports: []interface{}{5432, 6379}},
+		{Name: "db-2", Hostnames: []string{"db-2"}, RemoteHost: "localhost", JumpHost: "bastion.example.com", JumpPort: 2222, KeyPath: "~/.ssh/work", Ports: []interface{}{9000}},
+		{Name: "db-3", RemoteSocket: "/var/run/docker.sock", LocalSocket: "/tmp/docker.sock", JumpHost: "bastion.example.com", JumpPort: 2222, KeyPath: "~/.ssh/work"},
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts =\n%+v\nwant\n%+v", hosts, want)
+	}
+
+	joined := strings.Join(warnings, "\n")
+	for _, warning := range []string{
+		"Match blocks aren't supported", "Host web: ProxyJump isn't supported", "Host db: connects as",
+		"ignoring bind address 127.0.0.1", "listens on port 6379 rather than 6380", "listens on port 443 rather than 8443",
+	} {
+		if !strings.Contains(joined, warning) {
+			t.Errorf("warnings = %q, want one containing %q", warnings, warning)
+		}
+	}
+}
+
+func TestImportSSHConfig(t *testing.T) {
+	configPath := writeConfigFiles(t, map[string]string{
+		"config.yaml": `defaults:
+  jump_host: bastion.example.com
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: cache
+    ports: [6379]
+profiles:
+  dev:
+    hosts:
+      - local_ip: 127.0.0.4
+        remote_host: dev.internal
+        ports: [80]
+`,
+		"ssh_config": `Host cache
+  HostName bastion.example.com
+  LocalForward 6379 cache:6379
+
+Host db
+  HostName bastion.example.com
+  LocalForward 5432 db:5432
+
+Host api
+  HostName bastion.example.com
+  LocalForward 8080 api:8080
+`,
+	})
+
+	hosts, warnings, err := importSSHConfig(filepath.Join(filepath.Dir(configPath), "ssh_config"), configPath)
+	if err != nil {
+		t.Fatalf("importSSHConfig() error = %v", err)
+	}
+
+	var got []string
+	for _, host := range hosts {
+		got = append(got, host.Name+" "+host.LocalIP)
+	}
+	if want := []string{"db 127.0.0.3", "api 127.0.0.5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "already has a host named cache") {
+		t.Errorf("warnings = %q, want one about cache", warnings)
+	}
+}
+
+func TestInsertHosts(t *testing.T) {
+	hosts := []HostConfig{
+		{Name: "db", LocalIP: "127.0.0.3", RemoteHost: "db.internal", JumpHost: "bastion", Ports: []interface{}{5432}},
+		{Name: "api", LocalIP: "127.0.0.4", RemoteHost: "api.internal", JumpHost: "bastion", Ports: []interface{}{80, 443}},
+	}
+	entries := `  # Imported
+  - name: db
+    local_ip: 127.0.0.3
+    remote_host: db.internal
+    jump_host: bastion
+    ports: [5432]
+
+  # Imported
+  - name: api
+    local_ip: 127.0.0.4
+    remote_host: api.internal
+    jump_host: bastion
+    ports: [80, 443]
+`
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "before the next key and its comments",
+			content: `log_level: info # keep this
+
+hosts:
+  # The cache
+  - local_ip: 127.0.0.2
+    remote_host: cache
+    ports: [6379]
+
+# Profiles
+profiles: {}
+`,
+			want: `log_level: info # keep this
+
+hosts:
+  # The cache
+  - local_ip: 127.0.0.2
+    remote_host: cache
+    ports: [6379]
+
+` + entries + `
+# Profiles
+profiles: {}
+`,
+		},
+		{
+			name:    "at the end, with other indentation",
+			content: "hosts:\n- local_ip: 127.0.0.2\n  remote_host: cache\n  ports: [6379]",
+			want:    "hosts:\n- local_ip: 127.0.0.2\n  remote_host: cache\n  ports: [6379]\n\n" + strings.ReplaceAll(strings.TrimPrefix(entries, "  "), "\n  ", "\n"),
+		},
+		{
+			name:    "empty hosts",
+			content: "hosts:\nlog_level: info\n",
+			want:    "hosts:\n" + entries + "log_level: info\n",
+		},
+		{
+			name:    "no hosts",
+			content: "# Settings\nlog_level: info\n",
+			want:    "# Settings\nlog_level: info\n\nhosts:\n" + entries,
+		},
+		{
+			name:    "inline list",
+			content: "hosts: [{remote_host: cache}]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sequence, err := hostsSequence(hosts, "Imported")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := insertHosts([]byte(tt.content), sequence)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteImportedHosts(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": "# My hosts\nhosts:\n  - local_ip: 127.0.0.2\n    jump_host: bastion\n    remote_host: cache\n    ports: [6379]\n",
+	})
+
+	// A host that doesn't load leaves the file unchanged
+	invalid := []HostConfig{{Name: "db", LocalIP: "127.0.0.2", RemoteHost: "db", JumpHost: "bastion", Ports: []interface{}{6379}}}
+	if err := writeImportedHosts(path, invalid, "Imported"); err == nil || !strings.Contains(err.Error(), "leaving") {
+		t.Errorf("writeImportedHosts() error = %v, want the config left unchanged", err)
+	}
+
+	valid := []HostConfig{{Name: "db", LocalIP: "127.0.0.3", RemoteHost: "db", JumpHost: "bastion", Ports: []interface{}{5432}}}
+	if err := writeImportedHosts(path, valid, "Imported"); err != nil {
+		t.Fatalf("writeImportedHosts() error = %v", err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(config.Hosts) != 2 || config.Hosts[1].Name != "db" {
+		t.Errorf("hosts = %+v, want cache and db", config.Hosts)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "# My hosts\n") {
+		t.Errorf("comment not kept:\n%s", data)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StateFileName is the file runtime overrides are saved to, in the config file's directory
+const StateFileName = "state.yaml"
+
+// State holds settings changed at runtime that should survive restarts
+type State struct {
+	Profile string               `yaml:"profile,omitempty"` // Profile selected at runtime
+	Hosts   map[string]HostState `yaml:"hosts,omitempty"`   // Keyed by host name
+}
+
+// HostState holds runtime overrides for a single host
+type HostState struct {
+	Enabled *bool `yaml:"enabled,omitempty"` // Overrides the host's enabled setting
+}
+
+// StatePath returns where the state for the given config file is stored
+func StatePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), StateFileName)
+}
+
+// LoadState reads a state file, returning an empty state if it doesn't exist yet
+func LoadState(path string) (*State, error) {
+	state := &State{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state to path, replacing the previous file atomically
+func (s *State) Save(path string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// hostEnabled reports whether a host should be forwarded: its runtime override if one
+// is set, otherwise its config. A nil state has no overrides.
+func (s *State) hostEnabled(host HostConfig) bool {
+	if s == nil {
+		return host.isEnabled()
+	}
+	if override := s.Hosts[host.Name].Enabled; override != nil {
+		return *override
+	}
+	return host.isEnabled()
+}
+
+// setHostEnabled records a runtime override for a host. Overrides matching the config are
+// dropped so that the config file stays in charge of hosts the user hasn't toggled.
+func (s *State) setHostEnabled(host HostConfig, enabled bool) {
+	hostState := s.Hosts[host.Name]
+	if enabled == host.isEnabled() {
+		hostState.Enabled = nil
+	} else {
+		hostState.Enabled = &enabled
+	}
+
+	if hostState == (HostState{}) {
+		delete(s.Hosts, host.Name)
+		return
+	}
+	if s.Hosts == nil {
+		s.Hosts = make(map[string]HostState)
+	}
+	s.Hosts[host.Name] = hostState
+}
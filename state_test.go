@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStateMissing(t *testing.T) {
+	state, err := LoadState(filepath.Join(t.TempDir(), StateFileName))
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if len(state.Hosts) != 0 {
+		t.Errorf("LoadState() = %+v, want an empty state", state)
+	}
+}
+
+func TestStateSaveAndLoad(t *testing.T) {
+	path := StatePath(filepath.Join(t.TempDir(), "config.yaml"))
+	db := HostConfig{Name: "db"}
+
+	state := &State{}
+	state.setHostEnabled(db, false)
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if loaded.hostEnabled(db) {
+		t.Error("hostEnabled() = true after saving a disabled override")
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("state directory has %d files, want only %s", len(entries), StateFileName)
+	}
+}
+
+func TestStateHostEnabled(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name     string
+		host     HostConfig
+		toggle   *bool
+		want     bool
+		override bool // Whether an override should be stored
+	}{
+		{"enabled by default", HostConfig{Name: "a"}, nil, true, false},
+		{"disabled in config", HostConfig{Name: "a", Enabled: &disabled}, nil, false, false},
+		{"disabled at runtime", HostConfig{Name: "a"}, boolPtr(false), false, true},
+		{"enabled at runtime despite config", HostConfig{Name: "a", Enabled: &disabled}, boolPtr(true), true, true},
+		{"toggle matching config stores nothing", HostConfig{Name: "a"}, boolPtr(true), true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &State{Hosts: map[string]HostState{"a": {Enabled: boolPtr(!tt.want)}}}
+			if tt.toggle == nil {
+				state = &State{}
+			} else {
+				state.setHostEnabled(tt.host, *tt.toggle)
+			}
+
+			if got := state.hostEnabled(tt.host); got != tt.want {
+				t.Errorf("hostEnabled() = %v, want %v", got, tt.want)
+			}
+			if _, stored := state.Hosts["a"]; stored != tt.override {
+				t.Errorf("override stored = %v, want %v", stored, tt.override)
+			}
+		})
+	}
+
+	var none *State
+	if !none.hostEnabled(HostConfig{Name: "a"}) {
+		t.Error("nil state should fall back to the config")
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
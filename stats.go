@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ForwardStats is a point-in-time copy of the counters for a single forward
+type ForwardStats struct {
+	Listen            string // Local address or socket path the forward listens on
+	LocalIP           string
+	RemoteHost        string
+	Remote            string // Remote address or socket dialed through the jump host
+	Port              int
+	JumpHost          string
+	ActiveConnections int64
+	TotalConnections  int64
+	BytesIn           int64 // Bytes sent by local clients to the remote
+	BytesOut          int64 // Bytes sent by the remote back to local clients
+	Failures          int64
+	Rejected          int64            // Connections refused before forwarding (disallowed process or limits)
+	Clients           map[string]int64 // Connections per identified client process name
+	LastDialLatency   time.Duration
+	AvgDialLatency    time.Duration
+}
+
+// JumpHostStats is a point-in-time copy of the counters for a single jump host
+type JumpHostStats struct {
+	Address    string
+	Handshakes int64
+	Reconnects int64
+	Rejected   int64 // Connections refused by jump_host_limits
+}
+
+// StatsSnapshot contains all forward and jump host counters at a point in time
+type StatsSnapshot struct {
+	Taken     time.Time
+	Forwards  []ForwardStats
+	JumpHosts []JumpHostStats
+}
+
+// ActiveConnections returns the number of open connections across all forwards
+func (s StatsSnapshot) ActiveConnections() int64 {
+	var total int64
+	for _, fwd := range s.Forwards {
+		total += fwd.ActiveConnections
+	}
+	return total
+}
+
+// ConnectionSummary describes open, forwarded and rejected connections across all forwards,
+// as shown in the tray's status
+func (s StatsSnapshot) ConnectionSummary() string {
+	var total, rejected int64
+	for _, fwd := range s.Forwards {
+		total += fwd.TotalConnections
+		rejected += fwd.Rejected
+	}
+	return fmt.Sprintf("%d active, %d total, %d rejected", s.ActiveConnections(), total, rejected)
+}
+
+// forwardCounters holds the live counters for a single forward
+type forwardCounters struct {
+	info ForwardStats
+
+	active       atomic.Int64
+	total        atomic.Int64
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	failures     atomic.Int64
+	rejected     atomic.Int64
+	dials        atomic.Int64
+	dialNanos    atomic.Int64
+	lastDialNano atomic.Int64
+
+	clientsMu sync.Mutex
+	clients   map[string]int64
+}
+
+// jumpHostCounters holds the live counters for a single jump host
+type jumpHostCounters struct {
+	handshakes atomic.Int64
+	reconnects atomic.Int64
+	rejected   atomic.Int64
+}
+
+// Stats tracks traffic and connection counters in memory
+type Stats struct {
+	mu        sync.Mutex
+	forwards  map[string]*forwardCounters
+	jumpHosts map[string]*jumpHostCounters
+}
+
+// NewStats creates an empty stats registry
+func NewStats() *Stats {
+	return &Stats{
+		forwards:  make(map[string]*forwardCounters),
+		jumpHosts: make(map[string]*jumpHostCounters),
+	}
+}
+
+// forward returns the counters for a forward, creating them on first use
+func (s *Stats) forward(cfg ForwardConfig) *forwardCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, listen := cfg.ListenAddr()
+	if fc, exists := s.forwards[listen]; exists {
+		return fc
+	}
+
+	_, remote := cfg.RemoteAddr()
+	fc := &forwardCounters{
+		info: ForwardStats{
+			Listen:     listen,
+			LocalIP:    cfg.LocalIP,
+			RemoteHost: cfg.RemoteHost,
+			Remote:     remote,
+			Port:       cfg.Port,
+			JumpHost:   cfg.JumpHost,
+		},
+	}
+	s.forwards[listen] = fc
+	return fc
+}
+
+// jumpHost returns the counters for a jump host address, creating them on first use
+func (s *Stats) jumpHost(jumpAddr string) *jumpHostCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jc, exists := s.jumpHosts[jumpAddr]
+	if !exists {
+		jc = &jumpHostCounters{}
+		s.jumpHosts[jumpAddr] = jc
+	}
+	return jc
+}
+
+// recordHandshake counts a completed SSH handshake with a jump host
+func (s *Stats) recordHandshake(jumpAddr string) {
+	s.jumpHost(jumpAddr).handshakes.Add(1)
+}
+
+// recordReconnect counts a stale SSH connection being replaced
+func (s *Stats) recordReconnect(jumpAddr string) {
+	s.jumpHost(jumpAddr).reconnects.Add(1)
+}
+
+// recordJumpHostRejected counts a connection refused by a jump host limit
+func (s *Stats) recordJumpHostRejected(jumpAddr string) {
+	s.jumpHost(jumpAddr).rejected.Add(1)
+}
+
+// Snapshot returns a copy of all counters, sorted by listen address and jump host
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		Taken:     time.Now(),
+		Forwards:  make([]ForwardStats, 0, len(s.forwards)),
+		JumpHosts: make([]JumpHostStats, 0, len(s.jumpHosts)),
+	}
+
+	for _, fc := range s.forwards {
+		fwd := fc.info
+		fwd.ActiveConnections = fc.active.Load()
+		fwd.TotalConnections = fc.total.Load()
+		fwd.BytesIn = fc.bytesIn.Load()
+		fwd.BytesOut = fc.bytesOut.Load()
+		fwd.Failures = fc.failures.Load()
+		fwd.Rejected = fc.rejected.Load()
+		fwd.Clients = fc.clientCounts()
+		fwd.LastDialLatency = time.Duration(fc.lastDialNano.Load())
+		if dials := fc.dials.Load(); dials > 0 {
+			fwd.AvgDialLatency = time.Duration(fc.dialNanos.Load() / dials)
+		}
+		snapshot.Forwards = append(snapshot.Forwards, fwd)
+	}
+
+	for addr, jc := range s.jumpHosts {
+		snapshot.JumpHosts = append(snapshot.JumpHosts, JumpHostStats{
+			Address:    addr,
+			Handshakes: jc.handshakes.Load(),
+			Reconnects: jc.reconnects.Load(),
+			Rejected:   jc.rejected.Load(),
+		})
+	}
+
+	sort.Slice(snapshot.Forwards, func(i, j int) bool {
+		return snapshot.Forwards[i].Listen < snapshot.Forwards[j].Listen
+	})
+	sort.Slice(snapshot.JumpHosts, func(i, j int) bool {
+		return snapshot.JumpHosts[i].Address < snapshot.JumpHosts[j].Address
+	})
+
+	return snapshot
+}
+
+// connOpened counts a newly accepted local connection
+func (fc *forwardCounters) connOpened() {
+	fc.active.Add(1)
+	fc.total.Add(1)
+}
+
+// connClosed counts a local connection finishing
+func (fc *forwardCounters) connClosed() {
+	fc.active.Add(-1)
+}
+
+// dialed records the time taken to open the remote channel
+func (fc *forwardCounters) dialed(latency time.Duration) {
+	fc.dials.Add(1)
+	fc.dialNanos.Add(int64(latency))
+	fc.lastDialNano.Store(int64(latency))
+}
+
+// failed counts a connection that could not be forwarded
+func (fc *forwardCounters) failed() {
+	fc.failures.Add(1)
+}
+
+// rejectedConn counts a connection refused before forwarding
+func (fc *forwardCounters) rejectedConn() {
+	fc.rejected.Add(1)
+}
+
+// clientIdentified counts a connection from an identified client process
+func (fc *forwardCounters) clientIdentified(name string) {
+	fc.clientsMu.Lock()
+	defer fc.clientsMu.Unlock()
+
+	if fc.clients == nil {
+		fc.clients = make(map[string]int64)
+	}
+	fc.clients[name]++
+}
+
+// clientCounts returns a copy of the per-process connection counts
+func (fc *forwardCounters) clientCounts() map[string]int64 {
+	fc.clientsMu.Lock()
+	defer fc.clientsMu.Unlock()
+
+	if len(fc.clients) == 0 {
+		return nil
+	}
+	clients := make(map[string]int64, len(fc.clients))
+	for name, count := range fc.clients {
+		clients[name] = count
+	}
+	return clients
+}
+
+// countingWriter adds every byte written to one or more live counters
+type countingWriter struct {
+	w        io.Writer
+	counters []*atomic.Int64
+}
+
+// newCountingWriter wraps w so writes are added to each of the given counters
+func newCountingWriter(w io.Writer, counters ...*atomic.Int64) *countingWriter {
+	return &countingWriter{w: w, counters: counters}
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	for _, counter := range cw.counters {
+		counter.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsSnapshot(t *testing.T) {
+	stats := NewStats()
+	cfg := NewForwardConfig(HostConfig{
+		LocalIP:    "127.0.0.2",
+		RemoteHost: "db.example.com",
+		JumpHost:   "bastion.example.com",
+		JumpPort:   22,
+	}, 5432)
+
+	counters := stats.forward(cfg)
+	counters.connOpened()
+	counters.connOpened()
+	counters.connClosed()
+	counters.rejectedConn()
+	counters.dialed(10 * time.Millisecond)
+	counters.dialed(30 * time.Millisecond)
+	counters.failed()
+	counters.bytesIn.Add(100)
+	counters.bytesOut.Add(2000)
+
+	if stats.forward(cfg) != counters {
+		t.Error("forward() returned new counters for an existing forward")
+	}
+
+	stats.recordHandshake("bastion.example.com:22")
+	stats.recordHandshake("bastion.example.com:22")
+	stats.recordReconnect("bastion.example.com:22")
+
+	snapshot := stats.Snapshot()
+	if len(snapshot.Forwards) != 1 {
+		t.Fatalf("Expected 1 forward, got %d", len(snapshot.Forwards))
+	}
+
+	fwd := snapshot.Forwards[0]
+	if fwd.Listen != "127.0.0.2:5432" || fwd.Remote != "db.example.com:5432" {
+		t.Errorf("Forward = %s -> %s, want 127.0.0.2:5432 -> db.example.com:5432", fwd.Listen, fwd.Remote)
+	}
+	if fwd.ActiveConnections != 1 || fwd.TotalConnections != 2 {
+		t.Errorf("Connections = %d active / %d total, want 1 / 2", fwd.ActiveConnections, fwd.TotalConnections)
+	}
+	if fwd.BytesIn != 100 || fwd.BytesOut != 2000 {
+		t.Errorf("Bytes = %d in / %d out, want 100 / 2000", fwd.BytesIn, fwd.BytesOut)
+	}
+	if fwd.Failures != 1 {
+		t.Errorf("Failures = %d, want 1", fwd.Failures)
+	}
+	if fwd.LastDialLatency != 30*time.Millisecond || fwd.AvgDialLatency != 20*time.Millisecond {
+		t.Errorf("Dial latency = %s last / %s avg, want 30ms / 20ms", fwd.LastDialLatency, fwd.AvgDialLatency)
+	}
+	if snapshot.ActiveConnections() != 1 {
+		t.Errorf("ActiveConnections() = %d, want 1", snapshot.ActiveConnections())
+	}
+	if summary := snapshot.ConnectionSummary(); summary != "1 active, 2 total, 1 rejected" {
+		t.Errorf("ConnectionSummary() = %q, want \"1 active, 2 total, 1 rejected\"", summary)
+	}
+
+	if len(snapshot.JumpHosts) != 1 {
+		t.Fatalf("Expected 1 jump host, got %d", len(snapshot.JumpHosts))
+	}
+	if jh := snapshot.JumpHosts[0]; jh.Handshakes != 2 || jh.Reconnects != 1 {
+		t.Errorf("Jump host = %d handshakes / %d reconnects, want 2 / 1", jh.Handshakes, jh.Reconnects)
+	}
+}
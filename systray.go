@@ -1,29 +1,39 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/getlantern/systray"
 )
 
 type SystrayApp struct {
-	forwarder      *DynamicForwarder
-	mStart         *systray.MenuItem
-	mStop          *systray.MenuItem
-	mStatus        *systray.MenuItem
-	mStartAtLogin  *systray.MenuItem
-	mViewLogs      *systray.MenuItem
-	mQuit          *systray.MenuItem
+	forwarder     *DynamicForwarder
+	mStart        *systray.MenuItem
+	mStop         *systray.MenuItem
+	mFaults       *systray.MenuItem
+	mProfiles     *systray.MenuItem
+	profileItems  map[string]*systray.MenuItem // Keyed by profile name
+	mHosts        *systray.MenuItem
+	hostItems     map[string]*systray.MenuItem // Keyed by host name; items can't be removed, only hidden
+	hostItemsMu   sync.Mutex                   // Guards profileItems and hostItems
+	mStatus       *systray.MenuItem
+	mConnections  *systray.MenuItem
+	mStartAtLogin *systray.MenuItem
+	mViewLogs     *systray.MenuItem
+	mQuit         *systray.MenuItem
 }
 
 func NewSystrayApp(forwarder *DynamicForwarder) *SystrayApp {
 	return &SystrayApp{
-		forwarder: forwarder,
+		forwarder:    forwarder,
+		profileItems: make(map[string]*systray.MenuItem),
+		hostItems:    make(map[string]*systray.MenuItem),
 	}
 }
 
@@ -37,12 +47,19 @@ func (app *SystrayApp) onReady() {
 
 	app.mStatus = systray.AddMenuItem("Status: Stopped", "Current forwarding status")
 	app.mStatus.Disable()
+	app.mConnections = systray.AddMenuItem("Connections: 0 active", "Open forwarded connections")
+	app.mConnections.Disable()
 
 	systray.AddSeparator()
 
 	app.mStart = systray.AddMenuItem("Start Forwarding", "Start port forwarding")
 	app.mStop = systray.AddMenuItem("Stop Forwarding", "Stop port forwarding")
 	app.mStop.Disable()
+	app.mFaults = systray.AddMenuItemCheckbox("Inject Faults", "Toggle the fault injection configured for hosts", false)
+	app.mFaults.Hide()
+	app.mProfiles = systray.AddMenuItem("Profile", "Switch between the config's profiles")
+	app.mProfiles.Hide()
+	app.mHosts = systray.AddMenuItem("Hosts", "Enable or disable individual hosts")
 
 	systray.AddSeparator()
 
@@ -64,7 +81,10 @@ func (app *SystrayApp) onReady() {
 
 	go app.handleMenuEvents(mConfig)
 	go app.handleStatusUpdates()
+	go app.refreshStats()
 
+	app.refreshProfilesMenu()
+	app.refreshHostsMenu()
 	app.handleStart()
 }
 
@@ -75,6 +95,8 @@ func (app *SystrayApp) handleMenuEvents(mConfig *systray.MenuItem) {
 			app.handleStart()
 		case <-app.mStop.ClickedCh:
 			app.handleStop()
+		case <-app.mFaults.ClickedCh:
+			app.handleToggleFaults()
 		case <-mConfig.ClickedCh:
 			app.handleOpenConfig()
 		case <-app.mViewLogs.ClickedCh:
@@ -88,7 +110,8 @@ func (app *SystrayApp) handleMenuEvents(mConfig *systray.MenuItem) {
 }
 
 func (app *SystrayApp) handleStatusUpdates() {
-	for update := range app.forwarder.GetStatusChan() {
+	sub := app.forwarder.Subscribe(EventStatus)
+	for update := range sub.C {
 		switch update.Health {
 		case StatusHealthy:
 			app.mStatus.SetTitle("Status: Running")
@@ -103,14 +126,24 @@ func (app *SystrayApp) handleStatusUpdates() {
 	}
 }
 
+// refreshStats periodically shows connection counters from the forwarder's stats snapshot
+func (app *SystrayApp) refreshStats() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		app.mConnections.SetTitle("Connections: " + app.forwarder.Stats().ConnectionSummary())
+	}
+}
+
 func (app *SystrayApp) handleStart() {
 	if app.forwarder.IsRunning() {
 		return
 	}
 
-	log.Printf("Starting forwarder from systray...")
+	slog.Info("Starting forwarder from systray")
 	if err := app.forwarder.Start(); err != nil {
-		log.Printf("Error starting forwarder: %v", err)
+		slog.Error("Error starting forwarder", "error", err)
 		app.mStatus.SetTitle("Status: Error")
 		return
 	}
@@ -118,17 +151,145 @@ func (app *SystrayApp) handleStart() {
 	app.mStatus.SetTitle("Status: Running")
 	app.mStart.Disable()
 	app.mStop.Enable()
+	app.refreshFaultsItem()
+	app.refreshProfilesMenu()
+	app.refreshHostsMenu()
 	systray.SetTooltip("Portsmith - Running")
 }
 
+// refreshProfilesMenu shows the config's profiles with the active one checked, or hides
+// the menu when the config has no profiles
+func (app *SystrayApp) refreshProfilesMenu() {
+	app.hostItemsMu.Lock()
+	defer app.hostItemsMu.Unlock()
+
+	names, active := app.forwarder.Profiles()
+	if len(names) == 0 {
+		app.mProfiles.Hide()
+		return
+	}
+	app.mProfiles.Show()
+	if active != "" {
+		app.mProfiles.SetTitle("Profile: " + active)
+	} else {
+		app.mProfiles.SetTitle("Profile")
+	}
+
+	current := make(map[string]bool, len(names))
+	for _, name := range names {
+		current[name] = true
+
+		item, exists := app.profileItems[name]
+		if !exists {
+			item = app.mProfiles.AddSubMenuItemCheckbox(name, "Forward the hosts of "+name, false)
+			app.profileItems[name] = item
+			go app.handleProfileClicks(name, item)
+		}
+		item.Show()
+		if name == active {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+
+	for name, item := range app.profileItems {
+		if !current[name] {
+			item.Hide()
+		}
+	}
+}
+
+// handleProfileClicks switches to a profile each time its menu item is clicked
+func (app *SystrayApp) handleProfileClicks(name string, item *systray.MenuItem) {
+	for range item.ClickedCh {
+		if err := app.forwarder.SetProfile(name); err != nil {
+			slog.Error("Error switching profile", "profile", name, "error", err)
+		}
+		app.refreshFaultsItem()
+		app.refreshProfilesMenu()
+		app.refreshHostsMenu()
+	}
+}
+
+// refreshHostsMenu shows a checkbox per configured host, adding items for new hosts and
+// hiding those no longer in the config
+func (app *SystrayApp) refreshHostsMenu() {
+	app.hostItemsMu.Lock()
+	defer app.hostItemsMu.Unlock()
+
+	current := make(map[string]bool)
+	for _, host := range app.forwarder.Hosts() {
+		current[host.Name] = true
+
+		item, exists := app.hostItems[host.Name]
+		if !exists {
+			item = app.mHosts.AddSubMenuItemCheckbox(host.Name, "Forward "+host.Name, host.Enabled)
+			app.hostItems[host.Name] = item
+			go app.handleHostClicks(host.Name, item)
+		}
+		item.Show()
+		if host.Enabled {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+
+	for name, item := range app.hostItems {
+		if !current[name] {
+			item.Hide()
+		}
+	}
+}
+
+// handleHostClicks toggles a host each time its menu item is clicked
+func (app *SystrayApp) handleHostClicks(name string, item *systray.MenuItem) {
+	for range item.ClickedCh {
+		enabled := !item.Checked()
+		if err := app.forwarder.SetHostEnabled(name, enabled); err != nil {
+			slog.Error("Error toggling host", "host", name, "error", err)
+		}
+		app.refreshHostsMenu()
+	}
+}
+
+// refreshFaultsItem shows the fault injection toggle only when a host has faults configured
+func (app *SystrayApp) refreshFaultsItem() {
+	configured, enabled := false, false
+	for _, faults := range app.forwarder.Faults() {
+		if faults.configured() {
+			configured = true
+			enabled = enabled || faults.Enabled
+		}
+	}
+
+	if !configured {
+		app.mFaults.Hide()
+		return
+	}
+	app.mFaults.Show()
+	if enabled {
+		app.mFaults.Check()
+	} else {
+		app.mFaults.Uncheck()
+	}
+}
+
+func (app *SystrayApp) handleToggleFaults() {
+	enabled := !app.mFaults.Checked()
+	app.forwarder.SetFaultsEnabled(enabled)
+	app.refreshFaultsItem()
+}
+
 func (app *SystrayApp) handleStop() {
 	if !app.forwarder.IsRunning() {
 		return
 	}
 
-	log.Printf("Stopping forwarder from systray...")
+	slog.Info("Stopping forwarder from systray")
 	if err := app.forwarder.Stop(); err != nil {
-		log.Printf("Error stopping forwarder: %v", err)
+		slog.Error("Error stopping forwarder", "error", err)
 		return
 	}
 
@@ -141,31 +302,31 @@ func (app *SystrayApp) handleStop() {
 func (app *SystrayApp) handleOpenConfig() {
 	configPath, err := FindConfigPath()
 	if err != nil {
-		log.Printf("Failed to find config: %v", err)
+		slog.Error("Failed to find config", "error", err)
 		return
 	}
 
 	if err := openFile(configPath); err != nil {
-		log.Printf("Failed to open config: %v", err)
+		slog.Error("Failed to open config", "error", err)
 	}
 }
 
 func (app *SystrayApp) handleViewLogs() {
-	homeDir, err := os.UserHomeDir()
+	logDir, err := logDirectory()
 	if err != nil {
-		log.Printf("Failed to get home directory: %v", err)
+		slog.Error("Failed to get log directory", "error", err)
 		return
 	}
 
-	logFile := filepath.Join(homeDir, "Library", "Logs", "Portsmith", "portsmith.log")
+	logFile := filepath.Join(logDir, "portsmith.log")
 	if err := openFile(logFile); err != nil {
-		log.Printf("Failed to open log file: %v", err)
+		slog.Error("Failed to open log file", "error", err)
 	}
 }
 
 func (app *SystrayApp) onExit() {
 	if app.forwarder.IsRunning() {
-		log.Println("Systray exiting, stopping forwarder...")
+		slog.Info("Systray exiting, stopping forwarder")
 
 		done := make(chan struct{})
 		go func() {
@@ -175,9 +336,9 @@ func (app *SystrayApp) onExit() {
 
 		select {
 		case <-done:
-			log.Println("Forwarder stopped cleanly")
-		case <-time.After(3 * time.Second):
-			log.Println("Forwarder stop timed out, forcing exit")
+			slog.Info("Forwarder stopped cleanly")
+		case <-time.After(app.forwarder.DrainTimeout() + 3*time.Second):
+			slog.Warn("Forwarder stop timed out, forcing exit")
 		}
 	}
 }
@@ -200,18 +361,18 @@ func openFile(path string) error {
 func (app *SystrayApp) handleToggleStartAtLogin() {
 	if isStartAtLoginEnabled() {
 		if err := disableStartAtLogin(); err != nil {
-			log.Printf("Failed to disable start at login: %v", err)
+			slog.Error("Failed to disable start at login", "error", err)
 			return
 		}
 		app.mStartAtLogin.Uncheck()
-		log.Println("Start at login disabled")
+		slog.Info("Start at login disabled")
 	} else {
 		if err := enableStartAtLogin(); err != nil {
-			log.Printf("Failed to enable start at login: %v", err)
+			slog.Error("Failed to enable start at login", "error", err)
 			return
 		}
 		app.mStartAtLogin.Check()
-		log.Println("Start at login enabled")
+		slog.Info("Start at login enabled")
 	}
 }
 
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// hostError prefixes a problem with the host it was found in and where that host is defined
+func hostError(host HostConfig, err error) error {
+	if host.Source == "" {
+		return fmt.Errorf("host %s: %w", host.Name, err)
+	}
+	return fmt.Errorf("%s: host %s: %w", host.Source, host.Name, err)
+}
+
+// validateHosts checks each host's required settings, addresses and ports
+func validateHosts(config *Config) error {
+	var errs []error
+	for _, host := range config.Hosts {
+		for _, err := range host.validate() {
+			errs = append(errs, hostError(host, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate returns every problem with a host's own settings
+func (h HostConfig) validate() []error {
+	var errs []error
+
+	specs, err := ExpandPortSpecs(h)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	listensOnIP := false
+	for _, spec := range specs {
+		if spec.ListenSocket == "" {
+			listensOnIP = true
+		}
+	}
+
+	if h.JumpHost == "" {
+		errs = append(errs, fmt.Errorf("jump_host is required"))
+	} else if err := validateHostname(h.JumpHost); err != nil {
+		errs = append(errs, fmt.Errorf("invalid jump_host: %w", err))
+	}
+	if h.JumpPort < 1 || h.JumpPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid jump_port %d: must be between 1 and 65535", h.JumpPort))
+	}
+
+	if len(specs) > 0 && h.RemoteHost == "" && h.RemoteSocket == "" {
+		errs = append(errs, fmt.Errorf("remote_host or remote_socket is required to forward ports"))
+	}
+	if h.RemoteHost != "" {
+		if err := validateHostname(h.RemoteHost); err != nil {
+			errs = append(errs, fmt.Errorf("invalid remote_host: %w", err))
+		}
+	}
+
+	switch {
+	case h.LocalIP != "":
+		if ip := net.ParseIP(h.LocalIP); ip == nil || !ip.IsLoopback() {
+			errs = append(errs, fmt.Errorf("invalid local_ip %q: must be a loopback address like 127.0.0.2", h.LocalIP))
+		}
+	case listensOnIP:
+		errs = append(errs, fmt.Errorf("local_ip is required to forward ports"))
+	}
+
+	for _, hostname := range h.Hostnames {
+		if isIPAddress(hostname) {
+			errs = append(errs, fmt.Errorf("invalid hostname %q: must be a name, not an IP address", hostname))
+		} else if err := validateHostname(hostname); err != nil {
+			errs = append(errs, fmt.Errorf("invalid hostname: %w", err))
+		}
+	}
+	return errs
+}
+
+// validateHostname checks that s is an IP address or a syntactically valid DNS name
+func validateHostname(s string) error {
+	if isIPAddress(s) {
+		return nil
+	}
+	if len(s) > 253 {
+		return fmt.Errorf("%q is longer than 253 characters", s)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("%q is not a valid hostname: each dot-separated part must be 1-63 characters", s)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%q is not a valid hostname: parts must not start or end with a hyphen", s)
+		}
+		for _, c := range label {
+			if c != '-' && c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+				return fmt.Errorf("%q is not a valid hostname: unexpected character %q", s, c)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckKeyPaths reports key files that can't be read. A key_path that doesn't exist is only
+// reported if the host set it and has no identity_agent, since an agent can hold the key
+// instead. These depend on the machine rather than the config, so LoadConfig doesn't check them.
+func CheckKeyPaths(config *Config) []error {
+	var errs []error
+	checked := make(map[string]bool)
+	for _, host := range config.Hosts {
+		if checked[host.KeyPath] {
+			continue
+		}
+		checked[host.KeyPath] = true
+
+		path, err := ExpandKeyPath(host.KeyPath)
+		if err != nil {
+			errs = append(errs, hostError(host, err))
+			continue
+		}
+		file, err := os.Open(path)
+		if err == nil {
+			file.Close()
+			continue
+		}
+		if errors.Is(err, os.ErrNotExist) && (host.KeyPath == DefaultKeyPath || host.IdentityAgent != "") {
+			continue
+		}
+		errs = append(errs, hostError(host, fmt.Errorf("unreadable key_path: %w", err)))
+	}
+	return errs
+}
+
+var (
+	configType  = reflect.TypeOf(Config{})
+	hostType    = reflect.TypeOf(HostConfig{})
+	profileType = reflect.TypeOf(ProfileConfig{})
+	nodeType    = reflect.TypeOf(yaml.Node{})
+)
+
+// extraKeys lists settings that are read from the YAML directly rather than through a field
+var extraKeys = map[reflect.Type]map[string]reflect.Type{
+	configType:  {"include": reflect.TypeOf([]string{})},
+	profileType: {"hosts": reflect.TypeOf([]HostConfig{})},
+}
+
+// checkKnownKeys reports every mapping key in a config file that doesn't match a setting,
+// with its position, so a typo like jumphost isn't silently ignored
+func checkKnownKeys(root *yaml.Node, file string) []error {
+	var errs []error
+	walkKnownKeys(root, configType, "", func(key *yaml.Node, path string, known []string) {
+		message := fmt.Sprintf("%s:%d:%d: unknown setting %q", file, key.Line, key.Column, key.Value)
+		if path != "" {
+			message += " in " + path
+		}
+		if suggestion := closestKey(key.Value, known); suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		errs = append(errs, errors.New(message))
+	})
+	return errs
+}
+
+// walkKnownKeys calls unknown for each key of node that t has no setting for, then descends
+// into the values of known keys. yaml.Node fields hold host settings (defaults and templates).
+func walkKnownKeys(node *yaml.Node, t reflect.Type, path string, unknown func(key *yaml.Node, path string, known []string)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nodeType {
+		t = hostType
+	}
+
+	switch {
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for i, child := range node.Content {
+			walkKnownKeys(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i), unknown)
+		}
+
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkKnownKeys(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value), unknown)
+		}
+
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, exists := fields[key.Value]
+			if !exists {
+				known := make([]string, 0, len(fields))
+				for name := range fields {
+					known = append(known, name)
+				}
+				sort.Strings(known)
+				unknown(key, path, known)
+				continue
+			}
+			walkKnownKeys(node.Content[i+1], field, joinPath(path, key.Value), unknown)
+		}
+	}
+}
+
+// yamlFields maps the YAML keys of a struct type, including extraKeys, to their types
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	for name, extra := range extraKeys[t] {
+		fields[name] = extra
+	}
+	return fields
+}
+
+// joinPath appends a key to a dotted settings path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// closestKey returns the known key most similar to key, if any is close enough to be a typo
+func closestKey(key string, known []string) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+
+	best, bestDistance := "", 3
+	for _, candidate := range known {
+		if normalize(candidate) == normalize(key) {
+			return candidate
+		}
+		if distance := editDistance(key, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// runValidate checks a config file, with each of its profiles, and prints every problem found
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: portsmith validate [config.yaml]")
+		fmt.Fprintln(flags.Output(), "\nChecks the config, the files it includes and every profile, and lists all problems found.")
+	}
+	flags.Parse(args)
+
+	path, err := commandConfigPath(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	hosts, problems := validateConfigFile(path)
+	return reportValidation(os.Stdout, os.Stderr, path, hosts, problems)
+}
+
+// validateConfigFile loads a config with its default profile and then each other profile,
+// returning the number of hosts checked and every distinct problem
+func validateConfigFile(path string) (int, []string) {
+	var problems []string
+	seen := make(map[string]bool)
+	add := func(err error) {
+		for _, problem := range flattenErrors(err) {
+			if !seen[problem] {
+				seen[problem] = true
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		add(err)
+		if errors.Is(err, ErrUnknownProfile) {
+			return 0, problems
+		}
+	}
+
+	// The default profile failing to load doesn't stop the others being checked
+	var names []string
+	if config != nil {
+		names = config.ProfileNames()
+	} else if doc, err := loadConfigDocument(path); err == nil {
+		names = doc.profileOrder
+	}
+
+	hosts := make(map[string]bool)
+	record := func(config *Config) {
+		for _, host := range config.Hosts {
+			hosts[host.Name] = true
+		}
+		for _, err := range CheckKeyPaths(config) {
+			add(err)
+		}
+	}
+	if config != nil {
+		record(config)
+	}
+	for _, name := range names {
+		if config != nil && name == config.Profile {
+			continue
+		}
+		profileConfig, err := LoadConfigProfile(path, name)
+		if err != nil {
+			add(err)
+			continue
+		}
+		record(profileConfig)
+	}
+	return len(hosts), problems
+}
+
+// flattenErrors splits errors joined by errors.Join into their messages
+func flattenErrors(err error) []string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var messages []string
+		for _, err := range joined.Unwrap() {
+			messages = append(messages, flattenErrors(err)...)
+		}
+		return messages
+	}
+	return []string{err.Error()}
+}
+
+// reportValidation prints the result of validating a config and returns the exit code
+func reportValidation(stdout, stderr io.Writer, path string, hosts int, problems []string) int {
+	if len(problems) == 0 {
+		fmt.Fprintf(stdout, "%s is valid (%d hosts)\n", path, hosts)
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "%s has %d problem(s):\n", path, len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(stderr, "  %s\n", strings.ReplaceAll(problem, "\n", "\n    "))
+	}
+	return 1
+}
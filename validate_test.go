@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHostConfigValidate(t *testing.T) {
+	valid := HostConfig{
+		LocalIP:    "127.0.0.2",
+		RemoteHost: "db.example.com",
+		Hostnames:  []string{"db.local"},
+		JumpHost:   "bastion.example.com",
+		JumpPort:   22,
+		Ports:      []interface{}{5432},
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(h *HostConfig)
+		wantErr string
+	}{
+		{"valid", func(h *HostConfig) {}, ""},
+		{"IPv6 loopback", func(h *HostConfig) { h.LocalIP = "::1" }, ""},
+		{"IP jump host", func(h *HostConfig) { h.JumpHost = "192.0.2.1" }, ""},
+		{"socket only", func(h *HostConfig) {
+			h.LocalIP, h.RemoteHost, h.Ports = "", "", nil
+			h.RemoteSocket, h.LocalSocket = "/var/run/docker.sock", "/tmp/docker.sock"
+		}, ""},
+		{"non-loopback local_ip", func(h *HostConfig) { h.LocalIP = "10.0.0.2" }, "must be a loopback address"},
+		{"invalid local_ip", func(h *HostConfig) { h.LocalIP = "localhost" }, "must be a loopback address"},
+		{"missing local_ip", func(h *HostConfig) { h.LocalIP = "" }, "local_ip is required"},
+		{"missing jump_host", func(h *HostConfig) { h.JumpHost = "" }, "jump_host is required"},
+		{"missing remote_host", func(h *HostConfig) { h.RemoteHost = "" }, "remote_host or remote_socket is required"},
+		{"jump_port out of range", func(h *HostConfig) { h.JumpPort = 70000 }, "invalid jump_port"},
+		{"port out of range", func(h *HostConfig) { h.Ports = []interface{}{0} }, "invalid port 0"},
+		{"hostname with space", func(h *HostConfig) { h.Hostnames = []string{"db local"} }, "unexpected character"},
+		{"hostname is an IP", func(h *HostConfig) { h.Hostnames = []string{"10.0.0.1"} }, "not an IP address"},
+		{"empty label", func(h *HostConfig) { h.RemoteHost = "db..example.com" }, "1-63 characters"},
+		{"leading hyphen", func(h *HostConfig) { h.JumpHost = "-bastion.example.com" }, "hyphen"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := valid
+			tt.modify(&host)
+			errs := host.validate()
+			if tt.wantErr == "" {
+				if len(errs) > 0 {
+					t.Errorf("validate() = %v, want no errors", errs)
+				}
+				return
+			}
+			found := false
+			for _, err := range errs {
+				found = found || strings.Contains(err.Error(), tt.wantErr)
+			}
+			if !found {
+				t.Errorf("validate() = %v, want an error mentioning %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckKnownKeys(t *testing.T) {
+	path := writeConfig(t, `log_levle: debug
+include: []
+defaults:
+  jumphost: bastion.example.com
+templates:
+  work:
+    key_path: ~/.ssh/work
+    limits: {max_conections: 5}
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: db.example.com
+    jump_host: bastion.example.com
+    ports:
+      - {port: 80, listen_socket: /tmp/web.sock}
+    hooks: {on_conect: "true"}
+profiles:
+  dev:
+    hosts:
+      - local_ip: 127.0.0.3
+        remote_hots: api.example.com
+    defaults: {}
+    color: blue
+`)
+
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("LoadConfig() should fail on unknown settings")
+	}
+
+	for _, want := range []string{
+		`config.yaml:1:1: unknown setting "log_levle" (did you mean "log_level"?)`,
+		`config.yaml:4:3: unknown setting "jumphost" in defaults (did you mean "jump_host"?)`,
+		`config.yaml:8:14: unknown setting "max_conections" in templates.work.limits (did you mean "max_connections"?)`,
+		`config.yaml:15:13: unknown setting "on_conect" in hosts[0].hooks (did you mean "on_connect"?)`,
+		`config.yaml:20:9: unknown setting "remote_hots" in profiles.dev.hosts[0] (did you mean "remote_host"?)`,
+		`config.yaml:22:5: unknown setting "color" in profiles.dev`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v\nwant it to contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), `"color" in profiles.dev (did you mean`) {
+		t.Errorf("error = %v, want no suggestion for a key unlike any setting", err)
+	}
+}
+
+func TestLoadConfigReportsAllProblems(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, `drain_timeout: -1s
+hosts:
+  - name: db
+    local_ip: 10.0.0.2
+    remote_host: db.example.com
+    jump_host: bastion.example.com
+    ports: [5432]
+  - name: api
+    local_ip: 127.0.0.3
+    remote_host: api.example.com
+    ports: [443]
+    limits: {max_connections: -1}
+`))
+	if err == nil {
+		t.Fatal("LoadConfig() should fail")
+	}
+
+	for _, want := range []string{
+		"invalid drain_timeout",
+		`config.yaml:3: host db: invalid local_ip "10.0.0.2"`,
+		"config.yaml:8: host api: jump_host is required",
+		"config.yaml:8: host api: invalid limits.max_connections",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v\nwant it to contain %q", err, want)
+		}
+	}
+}
+
+func TestCheckKeyPaths(t *testing.T) {
+	dir := t.TempDir()
+	readable := filepath.Join(dir, "id_readable")
+	if err := os.WriteFile(readable, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{Hosts: []HostConfig{
+		{Name: "readable", KeyPath: readable},
+		{Name: "default", KeyPath: DefaultKeyPath + "-portsmith-test-missing"},
+		{Name: "agent", KeyPath: filepath.Join(dir, "agent_key"), IdentityAgent: "~/agent.sock"},
+		{Name: "missing", KeyPath: filepath.Join(dir, "missing")},
+		{Name: "missing-again", KeyPath: filepath.Join(dir, "missing")},
+	}}
+
+	errs := CheckKeyPaths(config)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	joined := strings.Join(messages, "\n")
+	if len(errs) != 2 || !strings.Contains(joined, "host default:") || !strings.Contains(joined, "host missing:") {
+		t.Errorf("CheckKeyPaths() = %v, want errors for the missing explicit key paths only, once each", joined)
+	}
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	path := writeConfig(t, `defaults:
+  jump_host: bastion.example.com
+hosts:
+  - local_ip: 127.0.0.2
+    remote_host: db.example.com
+    ports: [5432]
+profiles:
+  good:
+    hosts:
+      - local_ip: 127.0.0.3
+        remote_host: api.example.com
+        ports: [443]
+  bad:
+    hosts:
+      - local_ip: 127.0.0.2
+        remote_host: other.example.com
+        ports: [5432]
+`)
+
+	hosts, problems := validateConfigFile(path)
+	if len(problems) != 1 || !strings.Contains(problems[0], "port conflict") {
+		t.Errorf("problems = %v, want the bad profile's port conflict", problems)
+	}
+	if hosts != 2 {
+		t.Errorf("hosts = %d, want the hosts of the profiles that loaded", hosts)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := reportValidation(&stdout, &stderr, path, hosts, problems); code != 1 || !strings.Contains(stderr.String(), "1 problem(s)") {
+		t.Errorf("reportValidation() = %d, stderr %q", code, stderr.String())
+	}
+	stdout.Reset()
+	if code := reportValidation(&stdout, &stderr, path, 2, nil); code != 0 || !strings.Contains(stdout.String(), "is valid (2 hosts)") {
+		t.Errorf("reportValidation() = %d, stdout %q", code, stdout.String())
+	}
+}